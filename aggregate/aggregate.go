@@ -0,0 +1,348 @@
+// Package aggregate combines the check results of every kubernary instance in
+// a cluster.
+package aggregate
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	cfgNamespace string = "NAMESPACE"
+	cfgService   string = "SERVICE"
+	cfgPort      string = "PORT"
+	cfgPath      string = "PATH"
+	cfgTimeout   string = "TIMEOUT"
+
+	defaultNamespace string = "kubernary"
+	defaultService   string = "kubernary"
+	defaultPort      string = "10002"
+	defaultPath      string = "/health?version=2&cached=true"
+	defaultTimeout   string = "30s"
+
+	// name is used to load configuration from the environment, i.e.
+	// KUBERNARY_AGGREGATE_SERVICE.
+	name string = "aggregate"
+)
+
+// A Result is the outcome of one check on one kubernary instance.
+type Result struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+}
+
+// resultsV2 is the subset of version 2 of kubernary's JSON check result schema
+// used by the aggregator.
+type resultsV2 struct {
+	APIVersion string `json:"apiVersion"`
+	Checks     map[string]struct {
+		Status string `json:"status"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"checks"`
+}
+
+// decode decodes check results in either version of kubernary's JSON check
+// result schema. Checks that have not yet run are omitted.
+func decode(b []byte) (map[string]*Result, error) {
+	v2 := &resultsV2{}
+	if err := json.Unmarshal(b, v2); err == nil && v2.APIVersion == kubernary.APIVersionV2 {
+		results := map[string]*Result{}
+		for name, c := range v2.Checks {
+			switch c.Status {
+			case kubernary.StatusSkipped:
+				continue
+			case kubernary.StatusOK:
+				results[name] = &Result{OK: true}
+			default:
+				r := &Result{Error: "check is " + c.Status}
+				if c.Error != nil {
+					r.Error = c.Error.Message
+				}
+				results[name] = r
+			}
+		}
+		return results, nil
+	}
+	results := map[string]*Result{}
+	return results, errors.Wrap(json.Unmarshal(b, &results), "cannot decode JSON")
+}
+
+// A Tally counts the kubernary instances on which a check passed and failed.
+type Tally struct {
+	Passing int `json:"passing"`
+	Failing int `json:"failing"`
+}
+
+func (t *Tally) add(r *Result) {
+	if r.OK {
+		t.Passing++
+		return
+	}
+	t.Failing++
+}
+
+// A Check summarises one check's results across all kubernary instances.
+// Nodes maps each node to the results of each kubernary pod running on it.
+type Check struct {
+	Tally
+	Zones map[string]*Tally             `json:"zones"`
+	Nodes map[string]map[string]*Result `json:"nodes"`
+}
+
+// An Instance is the set of check results reported by one kubernary instance.
+type Instance struct {
+	kube.Peer
+	Error  string             `json:"error"`
+	Checks map[string]*Result `json:"checks"`
+}
+
+// A Report combines the check results of every kubernary instance.
+type Report struct {
+	Checks      map[string]*Check `json:"checks"`
+	Unreachable []*Instance       `json:"unreachable"`
+}
+
+// An Aggregator combines the check results of every kubernary instance.
+type Aggregator struct {
+	log       *zap.Logger
+	client    kubernetes.Interface
+	http      *http.Client
+	namespace string
+	service   string
+	port      string
+	path      string
+	timeout   time.Duration
+}
+
+// An Option represents an Aggregator option.
+type Option func(*Aggregator) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(a *Aggregator) error {
+		a.client = k
+		return nil
+	}
+}
+
+// HTTPClient allows the use of a bespoke HTTP client.
+func HTTPClient(h *http.Client) Option {
+	return func(a *Aggregator) error {
+		a.http = h
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(a *Aggregator) error {
+		a.log = l
+		return nil
+	}
+}
+
+// Service sets the namespace and name of the headless Service that selects all
+// kubernary pods.
+func Service(namespace, name string) Option {
+	return func(a *Aggregator) error {
+		a.namespace = namespace
+		a.service = name
+		return nil
+	}
+}
+
+// Port sets the port at which kubernary instances serve HTTP.
+func Port(p string) Option {
+	return func(a *Aggregator) error {
+		a.port = p
+		return nil
+	}
+}
+
+// Path sets the path from which to fetch each kubernary instance's results.
+func Path(p string) Option {
+	return func(a *Aggregator) error {
+		a.path = p
+		return nil
+	}
+}
+
+// Timeout sets the longest fetching results from all instances may take.
+func Timeout(t time.Duration) Option {
+	return func(a *Aggregator) error {
+		a.timeout = t
+		return nil
+	}
+}
+
+// New returns an Aggregator.
+func New(ao ...Option) (*Aggregator, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace: defaultNamespace,
+		cfgService:   defaultService,
+		cfgPort:      defaultPort,
+		cfgPath:      defaultPath,
+		cfgTimeout:   defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	a := &Aggregator{
+		log:       l,
+		namespace: cfg[cfgNamespace],
+		service:   cfg[cfgService],
+		port:      cfg[cfgPort],
+		path:      cfg[cfgPath],
+		timeout:   timeout,
+	}
+
+	for _, o := range ao {
+		if err := o(a); err != nil {
+			return nil, errors.Wrap(err, "cannot apply Aggregator option")
+		}
+	}
+
+	if a.http == nil {
+		a.http = &http.Client{}
+	}
+	if a.client == nil {
+		var err error
+		a.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return a, nil
+}
+
+func (a *Aggregator) fetch(ctx context.Context, p kube.Peer) *Instance {
+	i := &Instance{Peer: p, Checks: map[string]*Result{}}
+	u := "http://" + net.JoinHostPort(p.Address, a.port) + a.path
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		i.Error = errors.Wrap(err, "cannot create request").Error()
+		return i
+	}
+	rsp, err := a.http.Do(req.WithContext(ctx))
+	if err != nil {
+		i.Error = errors.Wrapf(err, "cannot GET %s", u).Error()
+		return i
+	}
+	defer rsp.Body.Close()
+
+	// kubernary returns 503 when any check fails, or 504 when checks only
+	// timed out, but still reports results.
+	switch rsp.StatusCode {
+	case http.StatusOK, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		i.Error = errors.Errorf("GET %s returned %s", u, rsp.Status).Error()
+		return i
+	}
+	b, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		i.Error = errors.Wrapf(err, "cannot read results from %s", u).Error()
+		return i
+	}
+	results, err := decode(b)
+	if err != nil {
+		i.Error = errors.Wrapf(err, "cannot decode results from %s", u).Error()
+		return i
+	}
+	i.Checks = results
+	return i
+}
+
+// Report fetches the results of every kubernary instance and combines them.
+func (a *Aggregator) Report() (*Report, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	peers, err := kube.Peers(ctx, a.client, a.namespace, a.service)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list kubernary instances")
+	}
+
+	instances := make(chan *Instance, len(peers))
+	wg := &sync.WaitGroup{}
+	for _, p := range peers {
+		wg.Add(1)
+		go func(p kube.Peer) {
+			defer wg.Done()
+			instances <- a.fetch(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+	close(instances)
+
+	r := &Report{Checks: map[string]*Check{}, Unreachable: []*Instance{}}
+	for i := range instances {
+		if i.Error != "" {
+			a.log.Debug("cannot fetch results", zap.String("pod", i.Pod), zap.String("error", i.Error))
+			r.Unreachable = append(r.Unreachable, i)
+			continue
+		}
+		for name, result := range i.Checks {
+			c, ok := r.Checks[name]
+			if !ok {
+				c = &Check{Zones: map[string]*Tally{}, Nodes: map[string]map[string]*Result{}}
+				r.Checks[name] = c
+			}
+			if _, ok := c.Zones[i.Zone]; !ok {
+				c.Zones[i.Zone] = &Tally{}
+			}
+			if _, ok := c.Nodes[i.Node]; !ok {
+				c.Nodes[i.Node] = map[string]*Result{}
+			}
+			c.add(result)
+			c.Zones[i.Zone].add(result)
+			c.Nodes[i.Node][i.Pod] = result
+		}
+	}
+	sort.Slice(r.Unreachable, func(i, j int) bool { return r.Unreachable[i].Pod < r.Unreachable[j].Pod })
+	return r, nil
+}
+
+// Handler returns an HTTP handler that serves a combined report of the results
+// of every kubernary instance as JSON.
+func (a *Aggregator) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		r, err := a.Report()
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "cannot aggregate results").Error(), http.StatusInternalServerError)
+			return
+		}
+		j, err := json.Marshal(r)
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "cannot marshal report").Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(j) // nolint: gas,errcheck
+	}
+}
@@ -0,0 +1,198 @@
+package aggregate
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// predictableTransport returns the configured results and status code for each
+// host, and fails to reach any host it has no results for. Results are returned
+// with status 503 unless otherwise configured.
+type predictableTransport struct {
+	results map[string]string
+	codes   map[string]int
+}
+
+func (t *predictableTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, ok := t.results[r.URL.Hostname()]
+	if !ok {
+		return nil, errors.Errorf("cannot connect to %s", r.URL.Host)
+	}
+	code := http.StatusServiceUnavailable
+	if c, ok := t.codes[r.URL.Hostname()]; ok {
+		code = c
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     strconv.Itoa(code) + " " + http.StatusText(code),
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+func endpoint(pod, node, zone, addr string) discoveryv1.Endpoint {
+	ready := true
+	return discoveryv1.Endpoint{
+		Addresses:  []string{addr},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		NodeName:   &node,
+		Zone:       &zone,
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod},
+	}
+}
+
+func TestReport(t *testing.T) {
+	eps := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "kubernary-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: defaultService},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("kubernary-a", "node-a", "us-east-1a", "10.0.0.1"),
+			endpoint("kubernary-b", "node-b", "us-east-1c", "10.0.0.2"),
+			endpoint("kubernary-c", "node-c", "us-east-1c", "10.0.0.3"),
+			endpoint("kubernary-d", "node-d", "us-east-1c", "10.0.0.4"),
+			endpoint("kubernary-e", "node-a", "us-east-1a", "10.0.0.5"),
+		},
+	}
+	h := &http.Client{Transport: &predictableTransport{results: map[string]string{
+		"10.0.0.1": `{"s3":{"ok":true,"error":""}}`,
+		"10.0.0.2": `{"s3":{"ok":false,"error":"Kaboom!"}}`,
+		"10.0.0.3": `{"s3":{"ok":false,"error":"Kaboom!"}}`,
+		"10.0.0.5": `{"s3":{"ok":false,"error":"Kaboom!"}}`,
+	}}}
+
+	a, err := New(Client(fake.NewSimpleClientset(eps)), HTTPClient(h))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	r, err := a.Report()
+	if err != nil {
+		t.Fatalf("a.Report(): %v", err)
+	}
+
+	s3, ok := r.Checks["s3"]
+	if !ok {
+		t.Fatalf("a.Report(): want s3 check, got %v", r.Checks)
+	}
+	if want := (Tally{Passing: 1, Failing: 3}); s3.Tally != want {
+		t.Errorf("s3.Tally: want %+v, got %+v", want, s3.Tally)
+	}
+	if want := (Tally{Passing: 1, Failing: 1}); *s3.Zones["us-east-1a"] != want {
+		t.Errorf("s3.Zones[us-east-1a]: want %+v, got %+v", want, *s3.Zones["us-east-1a"])
+	}
+	if want := (Tally{Failing: 2}); *s3.Zones["us-east-1c"] != want {
+		t.Errorf("s3.Zones[us-east-1c]: want %+v, got %+v", want, *s3.Zones["us-east-1c"])
+	}
+	if s3.Nodes["node-b"]["kubernary-b"].OK {
+		t.Errorf("s3.Nodes[node-b][kubernary-b].OK: want false, got true")
+	}
+
+	// Instances sharing a node must not overwrite each other's results.
+	if len(s3.Nodes["node-a"]) != 2 {
+		t.Fatalf("s3.Nodes[node-a]: want 2 pods, got %v", s3.Nodes["node-a"])
+	}
+	if !s3.Nodes["node-a"]["kubernary-a"].OK {
+		t.Errorf("s3.Nodes[node-a][kubernary-a].OK: want true, got false")
+	}
+	if s3.Nodes["node-a"]["kubernary-e"].OK {
+		t.Errorf("s3.Nodes[node-a][kubernary-e].OK: want false, got true")
+	}
+	if len(r.Unreachable) != 1 || r.Unreachable[0].Pod != "kubernary-d" {
+		t.Errorf("r.Unreachable: want [kubernary-d], got %v", r.Unreachable)
+	}
+}
+
+func TestReportV2(t *testing.T) {
+	eps := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "kubernary-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: defaultService},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("kubernary-a", "node-a", "us-east-1a", "10.0.0.1"),
+			endpoint("kubernary-b", "node-b", "us-east-1c", "10.0.0.2"),
+		},
+	}
+	h := &http.Client{Transport: &predictableTransport{results: map[string]string{
+		"10.0.0.1": `{"apiVersion":"kubernary/v2","status":"ok","checks":{"s3":{"status":"ok"},"dns":{"status":"skipped"}}}`,
+		"10.0.0.2": `{"apiVersion":"kubernary/v2","status":"failed","checks":{"s3":{"status":"failed","error":{"message":"Kaboom!"}},"dns":{"status":"stale"}}}`,
+	}}}
+
+	a, err := New(Client(fake.NewSimpleClientset(eps)), HTTPClient(h))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	r, err := a.Report()
+	if err != nil {
+		t.Fatalf("a.Report(): %v", err)
+	}
+
+	if want := (Tally{Passing: 1, Failing: 1}); r.Checks["s3"].Tally != want {
+		t.Errorf("s3.Tally: want %+v, got %+v", want, r.Checks["s3"].Tally)
+	}
+	if got := r.Checks["s3"].Nodes["node-b"]["kubernary-b"].Error; got != "Kaboom!" {
+		t.Errorf("s3.Nodes[node-b][kubernary-b].Error: want Kaboom!, got %q", got)
+	}
+	// Skipped checks have not yet run, so they neither pass nor fail.
+	if want := (Tally{Failing: 1}); r.Checks["dns"].Tally != want {
+		t.Errorf("dns.Tally: want %+v, got %+v", want, r.Checks["dns"].Tally)
+	}
+	if len(r.Unreachable) != 0 {
+		t.Errorf("r.Unreachable: want none, got %v", r.Unreachable)
+	}
+}
+
+func TestReportStatusCodes(t *testing.T) {
+	eps := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "kubernary-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: defaultService},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("kubernary-a", "node-a", "us-east-1a", "10.0.0.1"),
+			endpoint("kubernary-b", "node-b", "us-east-1a", "10.0.0.2"),
+			endpoint("kubernary-c", "node-c", "us-east-1a", "10.0.0.3"),
+		},
+	}
+	h := &http.Client{Transport: &predictableTransport{
+		results: map[string]string{
+			"10.0.0.1": `{"s3":{"ok":true,"error":""}}`,
+			"10.0.0.2": `{"s3":{"ok":false,"error":"check timed out","timeout":true}}`,
+			"10.0.0.3": `{"s3":{"ok":true,"error":""}}`,
+		},
+		codes: map[string]int{
+			"10.0.0.1": http.StatusOK,
+			"10.0.0.2": http.StatusGatewayTimeout,
+			"10.0.0.3": http.StatusInternalServerError,
+		},
+	}}
+
+	a, err := New(Client(fake.NewSimpleClientset(eps)), HTTPClient(h))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	r, err := a.Report()
+	if err != nil {
+		t.Fatalf("a.Report(): %v", err)
+	}
+
+	if want := (Tally{Passing: 1, Failing: 1}); r.Checks["s3"].Tally != want {
+		t.Errorf("s3.Tally: want %+v, got %+v", want, r.Checks["s3"].Tally)
+	}
+	if len(r.Unreachable) != 1 || r.Unreachable[0].Pod != "kubernary-c" {
+		t.Errorf("r.Unreachable: want [kubernary-c], got %v", r.Unreachable)
+	}
+}
@@ -0,0 +1,418 @@
+package certexpiry
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded     string = "succeeded"
+	metricFailed        string = "failed"
+	metricWarned        string = "warned"
+	metricDaysRemaining string = "days_remaining"
+
+	cfgEndpoints string = "ENDPOINTS"
+	cfgFiles     string = "FILES"
+	cfgSecrets   string = "SECRETS"
+	cfgWarnDays  string = "WARN_DAYS"
+	cfgFailDays  string = "FAIL_DAYS"
+	cfgCAFile    string = "CA_FILE"
+	cfgTimeout   string = "TIMEOUT"
+
+	defaultEndpoints string = ""
+	defaultFiles     string = ""
+	defaultSecrets   string = ""
+	defaultWarnDays  string = "30"
+	defaultFailDays  string = "7"
+	defaultCAFile    string = ""
+	defaultTimeout   string = "5s"
+
+	// SecretKey is the key of a Kubernetes TLS secret holding its certificate.
+	SecretKey string = "tls.crt"
+
+	// SecretCAKey is the key of a Kubernetes TLS secret holding the certificate
+	// authority that issued its certificate, if any.
+	SecretCAKey string = "ca.crt"
+
+	day = 24 * time.Hour
+)
+
+// A source loads a certificate chain, leaf first. A source may also load the
+// certificate authorities against which its chain should be verified.
+type source struct {
+	id       string
+	hostname string
+	load     func(ctx context.Context) ([]*x509.Certificate, *x509.CertPool, error)
+}
+
+type check struct {
+	name     string
+	stats    statsd.SubStatter
+	log      *zap.Logger
+	client   kubernetes.Interface
+	sources  []source
+	secrets  int
+	roots    *x509.CertPool
+	warnDays int
+	failDays int
+	timeout  time.Duration
+	now      func() time.Time
+}
+
+// An Option represents a certificate expiry checker option.
+type Option func(*check) error
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// Endpoint adds a host:port TLS endpoint whose certificate chain should be
+// checked. The certificate must be valid for the endpoint's host.
+func Endpoint(addr string) Option {
+	return func(c *check) error {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return errors.Wrapf(err, "cannot parse endpoint %s", addr)
+		}
+		c.sources = append(c.sources, source{id: addr, hostname: host, load: func(ctx context.Context) ([]*x509.Certificate, *x509.CertPool, error) {
+			chain, err := fromEndpoint(ctx, addr, host)
+			return chain, nil, err
+		}})
+		return nil
+	}
+}
+
+// File adds a file of PEM encoded certificates, leaf first, to check.
+func File(path string) Option {
+	return func(c *check) error {
+		c.sources = append(c.sources, source{id: path, load: func(_ context.Context) ([]*x509.Certificate, *x509.CertPool, error) {
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "cannot read %s", path)
+			}
+			chain, err := parsePEM(b)
+			return chain, nil, err
+		}})
+		return nil
+	}
+}
+
+// Secret adds a Kubernetes TLS secret to check. Secrets that include the
+// certificate authority that issued them, as cert-manager's do, are verified
+// against that certificate authority.
+func Secret(namespace, name string) Option {
+	return func(c *check) error {
+		id := namespace + "/" + name
+		c.secrets++
+		c.sources = append(c.sources, source{id: id, load: func(ctx context.Context) ([]*x509.Certificate, *x509.CertPool, error) {
+			s, err := c.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "cannot get secret %s", id)
+			}
+			b, ok := s.Data[SecretKey]
+			if !ok {
+				return nil, nil, errors.Errorf("secret %s has no %s key", id, SecretKey)
+			}
+			chain, err := parsePEM(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			ca, ok := s.Data[SecretCAKey]
+			if !ok {
+				return chain, nil, nil
+			}
+			roots := x509.NewCertPool()
+			if !roots.AppendCertsFromPEM(ca) {
+				return nil, nil, errors.Errorf("cannot parse %s of secret %s", SecretCAKey, id)
+			}
+			return chain, roots, nil
+		}})
+		return nil
+	}
+}
+
+// Thresholds sets the number of days remaining before expiry below which the
+// check warns, and below which it fails.
+func Thresholds(warnDays, failDays int) Option {
+	return func(c *check) error {
+		c.warnDays = warnDays
+		c.failDays = failDays
+		return nil
+	}
+}
+
+// CAFile causes certificate chains to be verified against the PEM encoded
+// certificate authorities in the supplied file rather than the system pool.
+func CAFile(f string) Option {
+	return func(c *check) error {
+		if f == "" {
+			return nil
+		}
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read CA file %s", f)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("cannot parse CA file %s", f)
+		}
+		c.roots = pool
+		return nil
+	}
+}
+
+// Timeout sets the longest loading any one certificate chain may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+func fromEndpoint(ctx context.Context, addr, host string) ([]*x509.Certificate, error) {
+	// Verification is skipped here so that we may inspect, and explain the
+	// problem with, certificates that would not verify.
+	d := &tls.Dialer{Config: &tls.Config{ServerName: host, InsecureSkipVerify: true}} // nolint: gas
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot connect to %s", addr)
+	}
+	defer conn.Close()
+	return conn.(*tls.Conn).ConnectionState().PeerCertificates, nil
+}
+
+func parsePEM(b []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot parse certificate")
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return certs, nil
+}
+
+// New returns a Checker that checks whether the supplied certificates are
+// valid and not close to expiry.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgEndpoints: defaultEndpoints,
+		cfgFiles:     defaultFiles,
+		cfgSecrets:   defaultSecrets,
+		cfgWarnDays:  defaultWarnDays,
+		cfgFailDays:  defaultFailDays,
+		cfgCAFile:    defaultCAFile,
+		cfgTimeout:   defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	warnDays, err := strconv.Atoi(cfg[cfgWarnDays])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgWarnDays)
+	}
+	failDays, err := strconv.Atoi(cfg[cfgFailDays])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgFailDays)
+	}
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:     name,
+		stats:    s.NewSubStatter(name),
+		log:      l,
+		warnDays: warnDays,
+		failDays: failDays,
+		timeout:  timeout,
+		now:      time.Now,
+	}
+
+	env := []Option{CAFile(cfg[cfgCAFile])}
+	for _, e := range kubernary.SplitConfigValue(cfg[cfgEndpoints]) {
+		env = append(env, Endpoint(e))
+	}
+	for _, f := range kubernary.SplitConfigValue(cfg[cfgFiles]) {
+		env = append(env, File(f))
+	}
+	for _, s := range kubernary.SplitConfigValue(cfg[cfgSecrets]) {
+		nn := strings.SplitN(s, "/", 2)
+		if len(nn) != 2 {
+			return nil, errors.Errorf("cannot parse %s: %s is not of the form namespace/name", cfgSecrets, s)
+		}
+		env = append(env, Secret(nn[0], nn[1]))
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply certificate expiry Checker option")
+		}
+	}
+
+	if len(c.sources) == 0 {
+		return nil, errors.New("certificate expiry Checker requires at least one endpoint, file or secret")
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name))
+
+	if c.client == nil && c.secrets > 0 {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return c, nil
+}
+
+// metricName converts a certificate source into a single statsd metric path
+// component.
+func metricName(id string) string {
+	return strings.NewReplacer(".", "_", ":", "_", "/", "_").Replace(id)
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+// verify ensures the chain's leaf certificate verifies using only the chain's
+// own intermediates, i.e. that the chain is complete. The chain is verified
+// against the supplied roots, if any, or else the check's roots.
+func (c *check) verify(src source, chain []*x509.Certificate, roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if roots == nil {
+		roots = c.roots
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       src.hostname,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   c.now(),
+	})
+	return errors.Wrap(err, "cannot verify certificate chain")
+}
+
+// checkSource returns the number of days until the first certificate in the
+// source's chain expires.
+func (c *check) checkSource(ctx context.Context, src source) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	chain, roots, err := src.load(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot load certificate chain")
+	}
+	if len(chain) == 0 {
+		return 0, errors.New("no certificates found")
+	}
+
+	expires := chain[0]
+	for _, cert := range chain[1:] {
+		if cert.NotAfter.Before(expires.NotAfter) {
+			expires = cert
+		}
+	}
+	days := int(math.Floor(expires.NotAfter.Sub(c.now()).Hours() / day.Hours()))
+	metric := metricName(src.id) + "." + metricDaysRemaining
+	if err := c.stats.Gauge(metric, int64(days), 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+
+	if days < c.failDays {
+		return days, errors.Errorf("certificate %q expires in %d days at %s", expires.Subject.CommonName, days, expires.NotAfter)
+	}
+	return days, c.verify(src, chain, roots)
+}
+
+func (c *check) checkSources(ctx context.Context) error {
+	failures := []string{}
+	for _, src := range c.sources {
+		days, err := c.checkSource(ctx, src)
+		if err != nil {
+			c.inc(metricName(src.id) + "." + metricFailed)
+			c.log.Error("certificate check failed", zap.String("source", src.id), zap.Error(err))
+			failures = append(failures, src.id+": "+err.Error())
+			continue
+		}
+		if days < c.warnDays {
+			c.inc(metricName(src.id) + "." + metricWarned)
+			c.log.Warn("certificate expires soon", zap.String("source", src.id), zap.Int("daysRemaining", days))
+		}
+		c.inc(metricName(src.id) + "." + metricSucceeded)
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("%d certificate chains failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext checks the configured certificate chains, giving up on any
+// that cannot be loaded before the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkSources(ctx); err != nil {
+		return errors.Wrapf(err, "%s certificate check failed", c.name)
+	}
+	c.log.Debug("certificate check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
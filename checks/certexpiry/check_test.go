@@ -0,0 +1,171 @@
+package certexpiry
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, cn string, expires time.Duration, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey(): %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(expires),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil || strings.HasPrefix(cn, "intermediate"),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate(%s): %v", cn, err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate(%s): %v", cn, err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func encode(certs ...*testCert) []byte {
+	b := []byte{}
+	for _, c := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})...)
+	}
+	return b
+}
+
+func writeTemp(t *testing.T, b []byte) string {
+	f, err := ioutil.TempFile("", "kubernary-certexpiry")
+	if err != nil {
+		t.Fatalf("ioutil.TempFile(): %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(b); err != nil {
+		t.Fatalf("f.Write(): %v", err)
+	}
+	return f.Name()
+}
+
+func TestCertExpiryCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+
+	year := 365 * day
+	root := newTestCert(t, "root", 10*year, nil)
+	intermediate := newTestCert(t, "intermediate", 5*year, root)
+	leaf := newTestCert(t, "leaf", year, intermediate)
+	soon := newTestCert(t, "soon", 20*day, intermediate)
+	sooner := newTestCert(t, "sooner", 2*day, intermediate)
+
+	ca := writeTemp(t, encode(root))
+	complete := writeTemp(t, encode(leaf, intermediate))
+	incomplete := writeTemp(t, encode(leaf))
+	warn := writeTemp(t, encode(soon, intermediate))
+	fail := writeTemp(t, encode(sooner, intermediate))
+	for _, f := range []string{ca, complete, incomplete, warn, fail} {
+		defer os.Remove(f)
+	}
+
+	k := fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubernary", Name: "tls"},
+			Data:       map[string][]byte{SecretKey: encode(leaf, intermediate)},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "kubernary", Name: "tls-ca"},
+			Data:       map[string][]byte{SecretKey: encode(leaf, intermediate), SecretCAKey: encode(root)},
+		},
+	)
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	srvCA := writeTemp(t, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	defer os.Remove(srvCA)
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	cases := []struct {
+		name    string
+		o       []Option
+		wantErr bool
+	}{
+		{name: "complete", o: []Option{CAFile(ca), File(complete)}},
+		{name: "incomplete", o: []Option{CAFile(ca), File(incomplete)}, wantErr: true},
+		{name: "untrusted", o: []Option{File(complete)}, wantErr: true},
+		{name: "warn", o: []Option{CAFile(ca), File(warn)}},
+		{name: "fail", o: []Option{CAFile(ca), File(fail)}, wantErr: true},
+		{name: "failthreshold", o: []Option{CAFile(ca), File(warn), Thresholds(60, 30)}, wantErr: true},
+		{name: "secret", o: []Option{CAFile(ca), Client(k), Secret("kubernary", "tls")}},
+		{name: "secretuntrusted", o: []Option{Client(k), Secret("kubernary", "tls")}, wantErr: true},
+		{name: "secretca", o: []Option{Client(k), Secret("kubernary", "tls-ca")}},
+		{name: "secretmissing", o: []Option{CAFile(ca), Client(k), Secret("kubernary", "nope")}, wantErr: true},
+		{name: "endpoint", o: []Option{CAFile(srvCA), Endpoint(addr)}},
+		{name: "endpointwrongname", o: []Option{CAFile(srvCA), Endpoint(strings.Replace(addr, "127.0.0.1", "localhost", 1))}, wantErr: true},
+	}
+
+	for _, tt := range cases {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{Logger(l)}, tt.o...)
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+	}
+}
+
+func TestCertExpirySecretWithoutClient(t *testing.T) {
+	// Outside a cluster New must fail to create a client for the secret rather
+	// than returning a checker that panics when run.
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		t.Skip("running in a Kubernetes cluster")
+	}
+	s, _ := statsd.NewNoopClient()
+	if _, err := New("secretnoclient", s, Secret("kubernary", "tls")); err == nil {
+		t.Error("New(secretnoclient, Secret(kubernary, tls)): want error, got nil")
+	}
+}
@@ -0,0 +1,353 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	metricLookupSucceeded string = "lookup.succeeded"
+	metricLookupFailed    string = "lookup.failed"
+	metricLookupNXDomain  string = "lookup.nxdomain"
+	metricLookupTimeout   string = "lookup.timeout"
+	metricLatency         string = "latency"
+
+	cfgNames       string = "NAMES"
+	cfgNameservers string = "NAMESERVERS"
+	cfgTimeout     string = "TIMEOUT"
+
+	defaultNames       string = "kubernetes.default.svc.cluster.local/A"
+	defaultNameservers string = ""
+	defaultTimeout     string = "1s"
+
+	systemResolver string = "system"
+)
+
+// Record types that may be looked up.
+const (
+	TypeA     string = "A"
+	TypeAAAA  string = "AAAA"
+	TypeCNAME string = "CNAME"
+	TypeTXT   string = "TXT"
+	TypeMX    string = "MX"
+	TypeNS    string = "NS"
+)
+
+// A Resolver looks up DNS records. *net.Resolver satisfies this interface.
+type Resolver interface {
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+}
+
+type record struct {
+	name  string
+	rtype string
+	want  []string
+}
+
+type check struct {
+	name      string
+	stats     statsd.SubStatter
+	log       *zap.Logger
+	records   []record
+	resolvers map[string]Resolver
+	timeout   time.Duration
+}
+
+func newResolver(nameserver string) Resolver {
+	d := &net.Dialer{}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, network, nameserver)
+		},
+	}
+}
+
+// An Option represents a DNS checker option.
+type Option func(*check) error
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Name adds a name to resolve. The lookup succeeds if at least one record of
+// the supplied type exists, and every wanted answer is among the records.
+func Name(n, rtype string, want ...string) Option {
+	return func(c *check) error {
+		rtype = strings.ToUpper(rtype)
+		switch rtype {
+		case TypeA, TypeAAAA, TypeCNAME, TypeTXT, TypeMX, TypeNS:
+		default:
+			return errors.Errorf("unsupported record type %s for name %s", rtype, n)
+		}
+		c.records = append(c.records, record{name: n, rtype: rtype, want: want})
+		return nil
+	}
+}
+
+// Nameserver adds a host:port nameserver to resolve names against. Names are
+// resolved using the system resolver if no nameservers are added.
+func Nameserver(addr string) Option {
+	return func(c *check) error {
+		c.resolvers[addr] = newResolver(addr)
+		return nil
+	}
+}
+
+// WithResolver allows the use of a bespoke named resolver.
+func WithResolver(id string, r Resolver) Option {
+	return func(c *check) error {
+		c.resolvers[id] = r
+		return nil
+	}
+}
+
+// Timeout sets the longest any one lookup may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// parseName parses a name of the form name/TYPE=answer|answer, where the type
+// and answers are optional.
+func parseName(v string) Option {
+	n, rtype, want := v, TypeA, []string{}
+	if i := strings.Index(n, "="); i >= 0 {
+		for _, a := range strings.Split(n[i+1:], "|") {
+			if a = strings.TrimSpace(a); a != "" {
+				want = append(want, a)
+			}
+		}
+		n = n[:i]
+	}
+	if i := strings.Index(n, "/"); i >= 0 {
+		rtype = n[i+1:]
+		n = n[:i]
+	}
+	return Name(n, rtype, want...)
+}
+
+// New returns a Checker that checks whether the supplied names resolve.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNames:       defaultNames,
+		cfgNameservers: defaultNameservers,
+		cfgTimeout:     defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:      name,
+		stats:     s.NewSubStatter(name),
+		log:       l,
+		resolvers: map[string]Resolver{},
+		timeout:   timeout,
+	}
+
+	env := []Option{}
+	for _, ns := range kubernary.SplitConfigValue(cfg[cfgNameservers]) {
+		env = append(env, Nameserver(ns))
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply DNS Checker option")
+		}
+	}
+
+	// Names configured via the environment are used only when no names were
+	// passed to New.
+	if len(c.records) == 0 {
+		for _, n := range kubernary.SplitConfigValue(cfg[cfgNames]) {
+			if err := parseName(n)(c); err != nil {
+				return nil, errors.Wrapf(err, "cannot parse %s", cfgNames)
+			}
+		}
+	}
+
+	if len(c.records) == 0 {
+		return nil, errors.New("DNS Checker requires at least one name")
+	}
+	if len(c.resolvers) == 0 {
+		c.resolvers[systemResolver] = net.DefaultResolver
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name))
+
+	return c, nil
+}
+
+// metricName converts a DNS name into a single statsd metric path component.
+func metricName(n string) string {
+	return strings.Replace(strings.TrimSuffix(n, "."), ".", "_", -1)
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func lookup(ctx context.Context, r Resolver, n record) ([]string, error) {
+	answers := []string{}
+	switch n.rtype {
+	case TypeA, TypeAAAA:
+		network := "ip4"
+		if n.rtype == TypeAAAA {
+			network = "ip6"
+		}
+		ips, err := r.LookupIP(ctx, network, n.name)
+		for _, ip := range ips {
+			answers = append(answers, ip.String())
+		}
+		return answers, err
+	case TypeCNAME:
+		cname, err := r.LookupCNAME(ctx, n.name)
+		if cname != "" {
+			answers = append(answers, cname)
+		}
+		return answers, err
+	case TypeTXT:
+		return r.LookupTXT(ctx, n.name)
+	case TypeMX:
+		mxs, err := r.LookupMX(ctx, n.name)
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+		return answers, err
+	case TypeNS:
+		nss, err := r.LookupNS(ctx, n.name)
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+		return answers, err
+	}
+	return nil, errors.Errorf("unsupported record type %s", n.rtype)
+}
+
+// normalize makes DNS names comparable regardless of case or trailing dots.
+func normalize(a string) string {
+	return strings.ToLower(strings.TrimSuffix(a, "."))
+}
+
+func missing(got, want []string) []string {
+	have := map[string]bool{}
+	for _, a := range got {
+		have[normalize(a)] = true
+	}
+	m := []string{}
+	for _, a := range want {
+		if !have[normalize(a)] {
+			m = append(m, a)
+		}
+	}
+	return m
+}
+
+func (c *check) checkRecord(ctx context.Context, id string, r Resolver, n record) error {
+	metric := func(m string) string { return metricName(n.name) + "." + m }
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	answers, err := lookup(ctx, r, n)
+	took := time.Since(started)
+
+	if serr := c.stats.TimingDuration(metric(metricLatency), took, 1.0); serr != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric(metricLatency)), zap.Error(serr))
+	}
+
+	if err != nil {
+		if derr, ok := errors.Cause(err).(*net.DNSError); ok {
+			switch {
+			case derr.IsNotFound:
+				c.inc(metric(metricLookupNXDomain))
+				return errors.Errorf("%s %s via %s: NXDOMAIN", n.name, n.rtype, id)
+			case derr.IsTimeout:
+				c.inc(metric(metricLookupTimeout))
+				return errors.Errorf("%s %s via %s: timed out after %s", n.name, n.rtype, id, took)
+			}
+		}
+		return errors.Wrapf(err, "%s %s via %s", n.name, n.rtype, id)
+	}
+	if len(answers) == 0 {
+		return errors.Errorf("%s %s via %s: no records", n.name, n.rtype, id)
+	}
+	if m := missing(answers, n.want); len(m) > 0 {
+		return errors.Errorf("%s %s via %s: want answers %s, got %s", n.name, n.rtype, id, strings.Join(m, ","), strings.Join(answers, ","))
+	}
+	return nil
+}
+
+func (c *check) checkRecords(ctx context.Context) error {
+	ids := make([]string, 0, len(c.resolvers))
+	for id := range c.resolvers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	failures := []string{}
+	for _, id := range ids {
+		for _, n := range c.records {
+			if err := c.checkRecord(ctx, id, c.resolvers[id], n); err != nil {
+				c.inc(metricName(n.name) + "." + metricLookupFailed)
+				c.log.Error("lookup failed", zap.String("resolver", id), zap.String("name", n.name), zap.String("type", n.rtype), zap.Error(err))
+				failures = append(failures, err.Error())
+				continue
+			}
+			c.inc(metricName(n.name) + "." + metricLookupSucceeded)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("%d lookups failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext performs the configured lookups, abandoning any that are in
+// flight when the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkRecords(ctx); err != nil {
+		return errors.Wrapf(err, "%s lookup check failed", c.name)
+	}
+	c.log.Debug("lookup check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
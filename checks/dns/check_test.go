@@ -0,0 +1,162 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+)
+
+type predictableResolver struct {
+	ips   []net.IP
+	cname string
+	txt   []string
+	err   error
+}
+
+func (r *predictableResolver) LookupIP(_ context.Context, _, _ string) ([]net.IP, error) {
+	return r.ips, r.err
+}
+
+func (r *predictableResolver) LookupCNAME(_ context.Context, _ string) (string, error) {
+	return r.cname, r.err
+}
+
+func (r *predictableResolver) LookupTXT(_ context.Context, _ string) ([]string, error) {
+	return r.txt, r.err
+}
+
+func (r *predictableResolver) LookupMX(_ context.Context, _ string) ([]*net.MX, error) {
+	return nil, r.err
+}
+
+func (r *predictableResolver) LookupNS(_ context.Context, _ string) ([]*net.NS, error) {
+	return nil, r.err
+}
+
+var checkTests = []struct {
+	name    string
+	r       *predictableResolver
+	o       []Option
+	wantErr bool
+}{
+	{
+		name: "a",
+		r:    &predictableResolver{ips: []net.IP{net.ParseIP("10.0.0.1")}},
+		o:    []Option{Name("kubernetes.default.svc.cluster.local", TypeA)},
+	},
+	{
+		name: "awant",
+		r:    &predictableResolver{ips: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}},
+		o:    []Option{Name("kubernetes.default.svc.cluster.local", TypeA, "10.0.0.2")},
+	},
+	{
+		name:    "awantmissing",
+		r:       &predictableResolver{ips: []net.IP{net.ParseIP("10.0.0.1")}},
+		o:       []Option{Name("kubernetes.default.svc.cluster.local", TypeA, "10.0.0.2")},
+		wantErr: true,
+	},
+	{
+		name:    "empty",
+		r:       &predictableResolver{},
+		o:       []Option{Name("kubernetes.default.svc.cluster.local", TypeA)},
+		wantErr: true,
+	},
+	{
+		name: "cname",
+		r:    &predictableResolver{cname: "Example.org."},
+		o:    []Option{Name("www.example.org", TypeCNAME, "example.org")},
+	},
+	{
+		name: "txt",
+		r:    &predictableResolver{txt: []string{"v=spf1 -all"}},
+		o:    []Option{Name("example.org", TypeTXT, "v=spf1 -all")},
+	},
+	{
+		name:    "nxdomain",
+		r:       &predictableResolver{err: &net.DNSError{Err: "no such host", Name: "nope.example.org", IsNotFound: true}},
+		o:       []Option{Name("nope.example.org", TypeA)},
+		wantErr: true,
+	},
+	{
+		name:    "timeout",
+		r:       &predictableResolver{err: &net.DNSError{Err: "i/o timeout", Name: "slow.example.org", IsTimeout: true}},
+		o:       []Option{Name("slow.example.org", TypeA)},
+		wantErr: true,
+	},
+	{
+		name:    "kaboom",
+		r:       &predictableResolver{err: errors.New("boom!")},
+		o:       []Option{Name("example.org", TypeA)},
+		wantErr: true,
+	},
+}
+
+func TestDNSCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{WithResolver("predictable", tt.r), Logger(l)}, tt.o...)
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+	}
+}
+
+var parseNameTests = []struct {
+	v       string
+	want    record
+	wantErr bool
+}{
+	{v: "example.org", want: record{name: "example.org", rtype: TypeA}},
+	{v: "example.org/aaaa", want: record{name: "example.org", rtype: TypeAAAA}},
+	{v: "www.example.org/CNAME=example.org", want: record{name: "www.example.org", rtype: TypeCNAME, want: []string{"example.org"}}},
+	{v: "example.org/A=10.0.0.1|10.0.0.2", want: record{name: "example.org", rtype: TypeA, want: []string{"10.0.0.1", "10.0.0.2"}}},
+	{v: "example.org/SOA", wantErr: true},
+}
+
+func TestParseName(t *testing.T) {
+	for _, tt := range parseNameTests {
+		c := &check{}
+		err := parseName(tt.v)(c)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseName(%v): want error, got nil", tt.v)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseName(%v): %v", tt.v, err)
+			continue
+		}
+		got := c.records[0]
+		if got.name != tt.want.name || got.rtype != tt.want.rtype || len(got.want) != len(tt.want.want) {
+			t.Errorf("parseName(%v): want %+v, got %+v", tt.v, tt.want, got)
+			continue
+		}
+		for i := range got.want {
+			if got.want[i] != tt.want.want[i] {
+				t.Errorf("parseName(%v): want %+v, got %+v", tt.v, tt.want, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,550 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	metricRequestSucceeded string = "request.succeeded"
+	metricRequestFailed    string = "request.failed"
+	metricLatency          string = "latency"
+	metricCode             string = "code"
+
+	cfgTarget             string = "TARGET"
+	cfgHealthService      string = "HEALTH_SERVICE"
+	cfgMethod             string = "METHOD"
+	cfgRequest            string = "REQUEST"
+	cfgDescriptorSet      string = "DESCRIPTOR_SET"
+	cfgExpectedCode       string = "EXPECTED_CODE"
+	cfgAssertions         string = "ASSERTIONS"
+	cfgTLS                string = "TLS"
+	cfgCAFile             string = "CA_FILE"
+	cfgCertFile           string = "CERT_FILE"
+	cfgKeyFile            string = "KEY_FILE"
+	cfgServerName         string = "SERVER_NAME"
+	cfgInsecureSkipVerify string = "INSECURE_SKIP_VERIFY"
+	cfgTimeout            string = "TIMEOUT"
+
+	defaultTarget             string = ""
+	defaultHealthService      string = ""
+	defaultMethod             string = ""
+	defaultRequest            string = "{}"
+	defaultDescriptorSet      string = ""
+	defaultExpectedCode       string = "OK"
+	defaultAssertions         string = ""
+	defaultTLS                string = "false"
+	defaultCAFile             string = ""
+	defaultCertFile           string = ""
+	defaultKeyFile            string = ""
+	defaultServerName         string = ""
+	defaultInsecureSkipVerify string = "false"
+	defaultTimeout            string = "10s"
+
+	healthCheckMethod string = "grpc.health.v1.Health/Check"
+)
+
+type check struct {
+	name       string
+	stats      statsd.SubStatter
+	log        *zap.Logger
+	conn       *grpc.ClientConn
+	target     string
+	service    string
+	method     string
+	request    []byte
+	files      *protoregistry.Files
+	code       codes.Code
+	assertions map[string]string
+	secure     bool
+	tls        *tls.Config
+	timeout    time.Duration
+}
+
+// An Option represents a gRPC checker option.
+type Option func(*check) error
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Target sets the gRPC target to call, e.g. example.org:443.
+func Target(t string) Option {
+	return func(c *check) error {
+		c.target = t
+		return nil
+	}
+}
+
+// HealthService sets the service name sent to the standard gRPC health
+// service. It is ignored when a method is supplied.
+func HealthService(s string) Option {
+	return func(c *check) error {
+		c.service = s
+		return nil
+	}
+}
+
+// Method sets an arbitrary unary method to call instead of the standard gRPC
+// health service, e.g. example.v1.Greeter/SayHello, and a protobuf JSON encoded
+// request to call it with. The method is described by the descriptor set, if
+// any, or else by the target's server reflection service.
+func Method(m string, request []byte) Option {
+	return func(c *check) error {
+		c.method = strings.TrimPrefix(m, "/")
+		c.request = request
+		return nil
+	}
+}
+
+// DescriptorSet loads method descriptors from the supplied file, which must
+// contain a serialized FileDescriptorSet as produced by protoc
+// --descriptor_set_out --include_imports.
+func DescriptorSet(f string) Option {
+	return func(c *check) error {
+		if f == "" {
+			return nil
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read descriptor set %s", f)
+		}
+		fds := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(b, fds); err != nil {
+			return errors.Wrapf(err, "cannot unmarshal descriptor set %s", f)
+		}
+		files, err := protodesc.NewFiles(fds)
+		if err != nil {
+			return errors.Wrapf(err, "cannot load descriptor set %s", f)
+		}
+		c.files = files
+		return nil
+	}
+}
+
+// ExpectedCode sets the gRPC status code considered healthy.
+func ExpectedCode(code codes.Code) Option {
+	return func(c *check) error {
+		c.code = code
+		return nil
+	}
+}
+
+// Assertion asserts that the value at the supplied path of the protobuf JSON
+// encoded response is equal to want. Paths are dot separated lowerCamelCase
+// field names or array indices, e.g. items.0.status. The standard gRPC health
+// service's response is asserted to have status SERVING if no assertions are
+// supplied.
+func Assertion(path, want string) Option {
+	return func(c *check) error {
+		c.assertions[path] = want
+		return nil
+	}
+}
+
+// TLS determines whether to connect to the target using TLS.
+func TLS(secure bool) Option {
+	return func(c *check) error {
+		c.secure = secure
+		return nil
+	}
+}
+
+// CAFile causes TLS certificates to be verified against the PEM encoded
+// certificate authorities in the supplied file rather than the system pool.
+func CAFile(f string) Option {
+	return func(c *check) error {
+		if f == "" {
+			return nil
+		}
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read CA file %s", f)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("cannot parse CA file %s", f)
+		}
+		c.tls.RootCAs = pool
+		return nil
+	}
+}
+
+// ClientCert sets the PEM encoded certificate and key files presented to the
+// target for mutual TLS.
+func ClientCert(certFile, keyFile string) Option {
+	return func(c *check) error {
+		if certFile == "" && keyFile == "" {
+			return nil
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return errors.Wrapf(err, "cannot load client certificate %s", certFile)
+		}
+		c.tls.Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// ServerName sets the TLS server name used for SNI and certificate
+// verification, if it differs from the target's host.
+func ServerName(n string) Option {
+	return func(c *check) error {
+		c.tls.ServerName = n
+		return nil
+	}
+}
+
+// InsecureSkipVerify disables TLS certificate verification.
+func InsecureSkipVerify(skip bool) Option {
+	return func(c *check) error {
+		c.tls.InsecureSkipVerify = skip
+		return nil
+	}
+}
+
+// Timeout sets the longest a call may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// parseCode parses a gRPC status code name, e.g. NOT_FOUND, or number.
+func parseCode(s string) (codes.Code, error) {
+	var code codes.Code
+	if _, err := strconv.Atoi(s); err == nil {
+		return code, errors.Wrapf(code.UnmarshalJSON([]byte(s)), "cannot parse code %s", s)
+	}
+	err := code.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(s))))
+	return code, errors.Wrapf(err, "cannot parse code %s", s)
+}
+
+// optionsFromEnv converts environment configuration into check options, which
+// are applied before any options passed to New.
+func optionsFromEnv(cfg map[string]string) ([]Option, error) {
+	o := []Option{
+		Target(cfg[cfgTarget]),
+		HealthService(cfg[cfgHealthService]),
+		Method(cfg[cfgMethod], []byte(cfg[cfgRequest])),
+		DescriptorSet(cfg[cfgDescriptorSet]),
+		CAFile(cfg[cfgCAFile]),
+		ClientCert(cfg[cfgCertFile], cfg[cfgKeyFile]),
+		ServerName(cfg[cfgServerName]),
+	}
+
+	code, err := parseCode(cfg[cfgExpectedCode])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgExpectedCode)
+	}
+	o = append(o, ExpectedCode(code))
+
+	for _, a := range kubernary.SplitConfigValue(cfg[cfgAssertions]) {
+		kv := strings.SplitN(a, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("cannot parse %s: %s is not of the form path=value", cfgAssertions, a)
+		}
+		o = append(o, Assertion(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])))
+	}
+
+	secure, err := strconv.ParseBool(cfg[cfgTLS])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTLS)
+	}
+	o = append(o, TLS(secure))
+
+	skip, err := strconv.ParseBool(cfg[cfgInsecureSkipVerify])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgInsecureSkipVerify)
+	}
+	o = append(o, InsecureSkipVerify(skip))
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+	o = append(o, Timeout(timeout))
+
+	return o, nil
+}
+
+// New returns a Checker that checks whether the supplied gRPC endpoint responds
+// as expected.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgTarget:             defaultTarget,
+		cfgHealthService:      defaultHealthService,
+		cfgMethod:             defaultMethod,
+		cfgRequest:            defaultRequest,
+		cfgDescriptorSet:      defaultDescriptorSet,
+		cfgExpectedCode:       defaultExpectedCode,
+		cfgAssertions:         defaultAssertions,
+		cfgTLS:                defaultTLS,
+		cfgCAFile:             defaultCAFile,
+		cfgCertFile:           defaultCertFile,
+		cfgKeyFile:            defaultKeyFile,
+		cfgServerName:         defaultServerName,
+		cfgInsecureSkipVerify: defaultInsecureSkipVerify,
+		cfgTimeout:            defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	env, err := optionsFromEnv(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read gRPC Checker configuration")
+	}
+
+	c := &check{
+		name:       name,
+		stats:      s.NewSubStatter(name),
+		log:        l,
+		assertions: map[string]string{},
+		tls:        &tls.Config{},
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply gRPC Checker option")
+		}
+	}
+
+	if c.target == "" {
+		return nil, errors.New("gRPC Checker requires a target")
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("target", c.target), zap.String("method", c.fullMethod()))
+
+	creds := insecure.NewCredentials()
+	if c.secure {
+		creds = credentials.NewTLS(c.tls)
+	}
+	// NewClient does not connect until the first call.
+	c.conn, err = grpc.NewClient(c.target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create gRPC client for %s", c.target)
+	}
+
+	return c, nil
+}
+
+// fullMethod returns the method to call, of the form package.Service/Method.
+func (c *check) fullMethod() string {
+	if c.method == "" {
+		return healthCheckMethod
+	}
+	return c.method
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+// reflect loads the file describing the supplied service, and its transitive
+// dependencies, from the target's server reflection service.
+func (c *check) reflect(ctx context.Context, service string) (*protoregistry.Files, error) {
+	stream, err := reflectionpb.NewServerReflectionClient(c.conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open server reflection stream")
+	}
+	defer stream.CloseSend() // nolint: errcheck
+
+	req := &reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	if err := stream.Send(req); err != nil {
+		return nil, errors.Wrap(err, "cannot send server reflection request")
+	}
+	rsp, err := stream.Recv()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot receive server reflection response")
+	}
+	if e := rsp.GetErrorResponse(); e != nil {
+		return nil, errors.Errorf("server reflection error: %s", e.GetErrorMessage())
+	}
+
+	fds := &descriptorpb.FileDescriptorSet{}
+	for _, b := range rsp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+		fd := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(b, fd); err != nil {
+			return nil, errors.Wrap(err, "cannot unmarshal file descriptor")
+		}
+		fds.File = append(fds.File, fd)
+	}
+	files, err := protodesc.NewFiles(fds)
+	return files, errors.Wrap(err, "cannot load file descriptors")
+}
+
+// describe returns the descriptor of the configured method.
+func (c *check) describe(ctx context.Context) (protoreflect.MethodDescriptor, error) {
+	sm := strings.SplitN(c.method, "/", 2)
+	if len(sm) != 2 {
+		return nil, errors.Errorf("method %s is not of the form package.Service/Method", c.method)
+	}
+	service, method := sm[0], sm[1]
+
+	files := c.files
+	if files == nil {
+		var err error
+		if files, err = c.reflect(ctx, service); err != nil {
+			return nil, errors.Wrapf(err, "cannot describe service %s", service)
+		}
+	}
+
+	d, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot find service %s", service)
+	}
+	sd, ok := d.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, errors.Errorf("%s is not a service", service)
+	}
+	md := sd.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		return nil, errors.Errorf("service %s has no method %s", service, method)
+	}
+	if md.IsStreamingClient() || md.IsStreamingServer() {
+		return nil, errors.Errorf("method %s is not unary", c.method)
+	}
+	return md, nil
+}
+
+// messages returns the request and an empty response for the configured
+// method, or for the standard health service.
+func (c *check) messages(ctx context.Context) (proto.Message, proto.Message, error) {
+	if c.method == "" {
+		return &healthpb.HealthCheckRequest{Service: c.service}, &healthpb.HealthCheckResponse{}, nil
+	}
+
+	md, err := c.describe(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot describe method")
+	}
+	req := dynamicpb.NewMessage(md.Input())
+	if err := protojson.Unmarshal(c.request, req); err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot unmarshal request for %s", c.method)
+	}
+	return req, dynamicpb.NewMessage(md.Output()), nil
+}
+
+func (c *check) assert(rsp proto.Message) error {
+	assertions := c.assertions
+	if len(assertions) == 0 && c.method == "" {
+		assertions = map[string]string{"status": healthpb.HealthCheckResponse_SERVING.String()}
+	}
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	// Emit unpopulated fields so that zero values may be asserted upon.
+	j, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(rsp)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal response")
+	}
+	var v interface{}
+	if err := json.Unmarshal(j, &v); err != nil {
+		return errors.Wrap(err, "cannot unmarshal response")
+	}
+	for path, want := range assertions {
+		got, err := kubernary.JSONValueAt(v, path)
+		if err != nil {
+			return errors.Wrapf(err, "cannot find response path %s", path)
+		}
+		if got == nil {
+			got = "null"
+		}
+		if fmt.Sprint(got) != want {
+			return errors.Errorf("response path %s: want %s, got %v", path, want, got)
+		}
+	}
+	return nil
+}
+
+func (c *check) checkCall(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, rsp, err := c.messages(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot build request")
+	}
+	started := time.Now()
+	err = c.conn.Invoke(ctx, "/"+c.fullMethod(), req, rsp)
+	took := time.Since(started)
+
+	s, ok := status.FromError(err)
+	if !ok {
+		return errors.Wrap(err, "cannot make call")
+	}
+	if err := c.stats.TimingDuration(metricLatency, took, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metricLatency), zap.Error(err))
+	}
+	c.inc(metricCode + "." + strings.ToLower(s.Code().String()))
+
+	if s.Code() != c.code {
+		return errors.Errorf("want status code %s, got %s: %s", c.code, s.Code(), s.Message())
+	}
+	if s.Code() != codes.OK {
+		return nil
+	}
+	return errors.Wrap(c.assert(rsp), "response assertion failed")
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext calls the configured method, abandoning the call if the supplied
+// context is done first.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkCall(ctx); err != nil {
+		c.inc(metricRequestFailed)
+		c.log.Error("gRPC check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s gRPC check failed", c.name)
+	}
+	c.inc(metricRequestSucceeded)
+	c.log.Debug("gRPC check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,145 @@
+package grpc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func testServer(t *testing.T) (string, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %v", err)
+	}
+	h := health.NewServer()
+	h.SetServingStatus("up", healthpb.HealthCheckResponse_SERVING)
+	h.SetServingStatus("down", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, h)
+	reflection.Register(s)
+	go s.Serve(l) // nolint: errcheck
+	return l.Addr().String(), s.Stop
+}
+
+// descriptorSet writes a descriptor set describing the standard gRPC health
+// service to a temporary file.
+func descriptorSet(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "kubernary")
+	if err != nil {
+		t.Fatalf("ioutil.TempDir(): %v", err)
+	}
+	fds := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)},
+	}
+	b, err := proto.Marshal(fds)
+	if err != nil {
+		t.Fatalf("proto.Marshal(): %v", err)
+	}
+	f := filepath.Join(dir, "health.pb")
+	if err := ioutil.WriteFile(f, b, 0600); err != nil {
+		t.Fatalf("ioutil.WriteFile(): %v", err)
+	}
+	return f, func() { os.RemoveAll(dir) } // nolint: errcheck
+}
+
+var checkTests = []struct {
+	name       string
+	o          []Option
+	descriptor bool
+	wantErr    bool
+}{
+	{name: "health"},
+	{name: "healthservice", o: []Option{HealthService("up")}},
+	{name: "healthnotserving", o: []Option{HealthService("down")}, wantErr: true},
+	{name: "healthnotfound", o: []Option{HealthService("missing")}, wantErr: true},
+	{name: "healthnotfoundexpected", o: []Option{HealthService("missing"), ExpectedCode(codes.NotFound)}},
+	{
+		name: "reflection",
+		o:    []Option{Method(healthCheckMethod, []byte(`{"service": "up"}`)), Assertion("status", "SERVING")},
+	},
+	{
+		name:    "reflectionmismatch",
+		o:       []Option{Method(healthCheckMethod, []byte(`{"service": "down"}`)), Assertion("status", "SERVING")},
+		wantErr: true,
+	},
+	{
+		name:    "reflectionmissingmethod",
+		o:       []Option{Method("grpc.health.v1.Health/Nope", []byte(`{}`))},
+		wantErr: true,
+	},
+	{
+		name:    "reflectionbadrequest",
+		o:       []Option{Method(healthCheckMethod, []byte(`{"nope": "up"}`))},
+		wantErr: true,
+	},
+	{
+		name:       "descriptorset",
+		o:          []Option{Method("/"+healthCheckMethod, []byte(`{"service": "down"}`)), Assertion("status", "NOT_SERVING")},
+		descriptor: true,
+	},
+}
+
+func TestGRPCCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	addr, stop := testServer(t)
+	defer stop()
+	ds, remove := descriptorSet(t)
+	defer remove()
+
+	for _, tt := range checkTests {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{Target(addr), Logger(l)}, tt.o...)
+		if tt.descriptor {
+			o = append(o, DescriptorSet(ds))
+		}
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted error", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error", tt.name, err)
+		}
+	}
+}
+
+func TestParseCode(t *testing.T) {
+	for s, want := range map[string]codes.Code{"OK": codes.OK, "not_found": codes.NotFound, "14": codes.Unavailable} {
+		got, err := parseCode(s)
+		if err != nil {
+			t.Errorf("parseCode(%s): %v", s, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("parseCode(%s): want %v, got %v", s, want, got)
+		}
+	}
+	if _, err := parseCode("KABOOM"); err == nil {
+		t.Error("parseCode(KABOOM): want error, got none")
+	}
+}
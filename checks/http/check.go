@@ -0,0 +1,474 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	metricRequestSucceeded string = "request.succeeded"
+	metricRequestFailed    string = "request.failed"
+	metricLatency          string = "latency"
+	metricLatencyWarned    string = "latency.warned"
+	metricLatencyExceeded  string = "latency.exceeded"
+
+	cfgMethod             string = "METHOD"
+	cfgURL                string = "URL"
+	cfgHeaders            string = "HEADERS"
+	cfgBody               string = "BODY"
+	cfgExpectedStatus     string = "EXPECTED_STATUS"
+	cfgBodyRegex          string = "BODY_REGEX"
+	cfgJSONAssertions     string = "JSON_ASSERTIONS"
+	cfgFollowRedirects    string = "FOLLOW_REDIRECTS"
+	cfgMaxRedirects       string = "MAX_REDIRECTS"
+	cfgInsecureSkipVerify string = "INSECURE_SKIP_VERIFY"
+	cfgCAFile             string = "CA_FILE"
+	cfgServerName         string = "SERVER_NAME"
+	cfgLatencyWarn        string = "LATENCY_WARN"
+	cfgLatencyBudget      string = "LATENCY_BUDGET"
+
+	defaultMethod             string = http.MethodGet
+	defaultURL                string = ""
+	defaultHeaders            string = ""
+	defaultBody               string = ""
+	defaultExpectedStatus     string = "200"
+	defaultBodyRegex          string = ""
+	defaultJSONAssertions     string = ""
+	defaultFollowRedirects    string = "true"
+	defaultMaxRedirects       string = "10"
+	defaultInsecureSkipVerify string = "false"
+	defaultCAFile             string = ""
+	defaultServerName         string = ""
+	defaultLatencyWarn        string = "0s"
+	defaultLatencyBudget      string = "0s"
+
+	// Requests should never take this long, but we don't want to hang forever.
+	defaultClientTimeout = 30 * time.Second
+)
+
+type check struct {
+	name       string
+	stats      statsd.SubStatter
+	log        *zap.Logger
+	client     *http.Client
+	method     string
+	url        string
+	headers    http.Header
+	body       []byte
+	status     map[int]bool
+	bodyRegex  *regexp.Regexp
+	assertions map[string]string
+	follow     bool
+	redirects  int
+	tls        *tls.Config
+	warn       time.Duration
+	budget     time.Duration
+}
+
+// An Option represents an HTTP checker option.
+type Option func(*check) error
+
+// HTTPClient allows the use of a bespoke HTTP client. The redirect policy and
+// TLS options are ignored when a bespoke client is supplied.
+func HTTPClient(h *http.Client) Option {
+	return func(c *check) error {
+		c.client = h
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Method sets the HTTP request method.
+func Method(m string) Option {
+	return func(c *check) error {
+		c.method = strings.ToUpper(m)
+		return nil
+	}
+}
+
+// URL sets the URL to request.
+func URL(u string) Option {
+	return func(c *check) error {
+		c.url = u
+		return nil
+	}
+}
+
+// Header adds an HTTP request header.
+func Header(k, v string) Option {
+	return func(c *check) error {
+		c.headers.Add(k, v)
+		return nil
+	}
+}
+
+// Body sets the HTTP request body.
+func Body(b []byte) Option {
+	return func(c *check) error {
+		c.body = b
+		return nil
+	}
+}
+
+// ExpectedStatus sets the HTTP response status codes considered healthy.
+func ExpectedStatus(codes ...int) Option {
+	return func(c *check) error {
+		c.status = map[int]bool{}
+		for _, code := range codes {
+			c.status[code] = true
+		}
+		return nil
+	}
+}
+
+// BodyRegex sets a regular expression the response body must match.
+func BodyRegex(r string) Option {
+	return func(c *check) error {
+		if r == "" {
+			c.bodyRegex = nil
+			return nil
+		}
+		re, err := regexp.Compile(r)
+		if err != nil {
+			return errors.Wrapf(err, "cannot compile body regex %s", r)
+		}
+		c.bodyRegex = re
+		return nil
+	}
+}
+
+// JSONAssertion asserts that the value at the supplied path of a JSON response
+// body is equal to want. Paths are dot separated object keys or array indices,
+// e.g. items.0.status.
+func JSONAssertion(path, want string) Option {
+	return func(c *check) error {
+		c.assertions[path] = want
+		return nil
+	}
+}
+
+// FollowRedirects determines whether up to max redirects are followed. The
+// redirect response itself is asserted upon when redirects are not followed.
+func FollowRedirects(follow bool, max int) Option {
+	return func(c *check) error {
+		c.follow = follow
+		c.redirects = max
+		return nil
+	}
+}
+
+// InsecureSkipVerify disables TLS certificate verification.
+func InsecureSkipVerify(skip bool) Option {
+	return func(c *check) error {
+		c.tls.InsecureSkipVerify = skip
+		return nil
+	}
+}
+
+// CAFile causes TLS certificates to be verified against the PEM encoded
+// certificate authorities in the supplied file rather than the system pool.
+func CAFile(f string) Option {
+	return func(c *check) error {
+		if f == "" {
+			return nil
+		}
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read CA file %s", f)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("cannot parse CA file %s", f)
+		}
+		c.tls.RootCAs = pool
+		return nil
+	}
+}
+
+// ServerName sets the TLS server name used for SNI and certificate
+// verification, if it differs from the URL's host.
+func ServerName(n string) Option {
+	return func(c *check) error {
+		c.tls.ServerName = n
+		return nil
+	}
+}
+
+// LatencyThresholds sets the latency above which a request is considered slow,
+// and the latency above which the check fails. Zero disables a threshold.
+func LatencyThresholds(warn, budget time.Duration) Option {
+	return func(c *check) error {
+		c.warn = warn
+		c.budget = budget
+		return nil
+	}
+}
+
+// splitPair splits a configuration value of the form k<sep>v.
+func splitPair(v, sep string) (string, string, error) {
+	kv := strings.SplitN(v, sep, 2)
+	if len(kv) != 2 {
+		return "", "", errors.Errorf("%s is not of the form key%svalue", v, sep)
+	}
+	return strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]), nil
+}
+
+// optionsFromEnv converts environment configuration into check options, which
+// are applied before any options passed to New.
+func optionsFromEnv(cfg map[string]string) ([]Option, error) {
+	o := []Option{
+		Method(cfg[cfgMethod]),
+		URL(cfg[cfgURL]),
+		Body([]byte(cfg[cfgBody])),
+		BodyRegex(cfg[cfgBodyRegex]),
+		CAFile(cfg[cfgCAFile]),
+		ServerName(cfg[cfgServerName]),
+	}
+
+	for _, h := range kubernary.SplitConfigValue(cfg[cfgHeaders]) {
+		k, v, err := splitPair(h, ":")
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse %s", cfgHeaders)
+		}
+		o = append(o, Header(k, v))
+	}
+
+	codes := []int{}
+	for _, s := range kubernary.SplitConfigValue(cfg[cfgExpectedStatus]) {
+		code, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse %s", cfgExpectedStatus)
+		}
+		codes = append(codes, code)
+	}
+	o = append(o, ExpectedStatus(codes...))
+
+	for _, a := range kubernary.SplitConfigValue(cfg[cfgJSONAssertions]) {
+		k, v, err := splitPair(a, "=")
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot parse %s", cfgJSONAssertions)
+		}
+		o = append(o, JSONAssertion(k, v))
+	}
+
+	follow, err := strconv.ParseBool(cfg[cfgFollowRedirects])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgFollowRedirects)
+	}
+	max, err := strconv.Atoi(cfg[cfgMaxRedirects])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgMaxRedirects)
+	}
+	o = append(o, FollowRedirects(follow, max))
+
+	skip, err := strconv.ParseBool(cfg[cfgInsecureSkipVerify])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgInsecureSkipVerify)
+	}
+	o = append(o, InsecureSkipVerify(skip))
+
+	warn, err := time.ParseDuration(cfg[cfgLatencyWarn])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgLatencyWarn)
+	}
+	budget, err := time.ParseDuration(cfg[cfgLatencyBudget])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgLatencyBudget)
+	}
+	o = append(o, LatencyThresholds(warn, budget))
+
+	return o, nil
+}
+
+func (c *check) newClient() *http.Client {
+	return &http.Client{
+		Timeout:   defaultClientTimeout,
+		Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: c.tls},
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if !c.follow {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > c.redirects {
+				return errors.Errorf("stopped after %d redirects", c.redirects)
+			}
+			return nil
+		},
+	}
+}
+
+// New returns a Checker that checks whether the supplied HTTP endpoint responds
+// as expected.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgMethod:             defaultMethod,
+		cfgURL:                defaultURL,
+		cfgHeaders:            defaultHeaders,
+		cfgBody:               defaultBody,
+		cfgExpectedStatus:     defaultExpectedStatus,
+		cfgBodyRegex:          defaultBodyRegex,
+		cfgJSONAssertions:     defaultJSONAssertions,
+		cfgFollowRedirects:    defaultFollowRedirects,
+		cfgMaxRedirects:       defaultMaxRedirects,
+		cfgInsecureSkipVerify: defaultInsecureSkipVerify,
+		cfgCAFile:             defaultCAFile,
+		cfgServerName:         defaultServerName,
+		cfgLatencyWarn:        defaultLatencyWarn,
+		cfgLatencyBudget:      defaultLatencyBudget,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	env, err := optionsFromEnv(cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read HTTP Checker configuration")
+	}
+
+	c := &check{
+		name:       name,
+		stats:      s.NewSubStatter(name),
+		log:        l,
+		headers:    http.Header{},
+		assertions: map[string]string{},
+		tls:        &tls.Config{},
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply HTTP Checker option")
+		}
+	}
+
+	if c.url == "" {
+		return nil, errors.New("HTTP Checker requires a URL")
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("method", c.method), zap.String("url", c.url))
+
+	if c.client == nil {
+		c.client = c.newClient()
+	}
+
+	return c, nil
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) assertJSON(body []byte) error {
+	if len(c.assertions) == 0 {
+		return nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return errors.Wrap(err, "cannot unmarshal response body")
+	}
+	for path, want := range c.assertions {
+		got, err := kubernary.JSONValueAt(v, path)
+		if err != nil {
+			return errors.Wrapf(err, "cannot find JSON path %s", path)
+		}
+		if got == nil {
+			got = "null"
+		}
+		if fmt.Sprint(got) != want {
+			return errors.Errorf("JSON path %s: want %s, got %v", path, want, got)
+		}
+	}
+	return nil
+}
+
+func (c *check) checkRequest(ctx context.Context) error {
+	r, err := http.NewRequest(c.method, c.url, bytes.NewReader(c.body))
+	if err != nil {
+		return errors.Wrap(err, "cannot create request")
+	}
+	for k, v := range c.headers {
+		r.Header[k] = v
+	}
+	if h := c.headers.Get("Host"); h != "" {
+		r.Host = h
+	}
+
+	started := time.Now()
+	rsp, err := c.client.Do(r.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "cannot make request")
+	}
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return errors.Wrap(err, "cannot read response body")
+	}
+	took := time.Since(started)
+
+	if err := c.stats.TimingDuration(metricLatency, took, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metricLatency), zap.Error(err))
+	}
+	if c.budget > 0 && took > c.budget {
+		c.inc(metricLatencyExceeded)
+		return errors.Errorf("request took %s, exceeding latency budget of %s", took, c.budget)
+	}
+	if c.warn > 0 && took > c.warn {
+		c.inc(metricLatencyWarned)
+		c.log.Warn("request was slow", zap.Duration("took", took), zap.Duration("threshold", c.warn))
+	}
+
+	if !c.status[rsp.StatusCode] {
+		return errors.Errorf("unexpected response status %s", rsp.Status)
+	}
+	if c.bodyRegex != nil && !c.bodyRegex.Match(body) {
+		return errors.Errorf("response body does not match %s", c.bodyRegex)
+	}
+	return errors.Wrap(c.assertJSON(body), "JSON assertion failed")
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext makes the configured request, abandoning it if the supplied
+// context is done first.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkRequest(ctx); err != nil {
+		c.inc(metricRequestFailed)
+		c.log.Error("request check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s request check failed", c.name)
+	}
+	c.inc(metricRequestSucceeded)
+	c.log.Debug("request check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,140 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+func testHandler() http.Handler {
+	m := http.NewServeMux()
+	m.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": {"ok": true}, "items": [{"name": "kubernary"}]}`)
+	})
+	m.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s", r.Method, r.Header.Get("X-Kubernary"), b)
+	})
+	m.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ok", http.StatusFound)
+	})
+	m.HandleFunc("/slow", func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	m.HandleFunc("/broken", func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "kaboom", http.StatusInternalServerError)
+	})
+	return m
+}
+
+var checkTests = []struct {
+	name    string
+	path    string
+	o       []Option
+	wantErr bool
+}{
+	{name: "ok", path: "/ok"},
+	{name: "broken", path: "/broken", wantErr: true},
+	{name: "brokenexpected", path: "/broken", o: []Option{ExpectedStatus(http.StatusInternalServerError)}},
+	{name: "regex", path: "/ok", o: []Option{BodyRegex(`"name": "kuber`)}},
+	{name: "regexmismatch", path: "/ok", o: []Option{BodyRegex(`nope`)}, wantErr: true},
+	{name: "json", path: "/ok", o: []Option{JSONAssertion("status.ok", "true"), JSONAssertion("items.0.name", "kubernary")}},
+	{name: "jsonmismatch", path: "/ok", o: []Option{JSONAssertion("status.ok", "false")}, wantErr: true},
+	{name: "jsonmissing", path: "/ok", o: []Option{JSONAssertion("items.1.name", "kubernary")}, wantErr: true},
+	{name: "echo", path: "/echo", o: []Option{Method("post"), Header("X-Kubernary", "hi"), Body([]byte("there")), BodyRegex("^POST hi there$")}},
+	{name: "redirect", path: "/redirect"},
+	{name: "redirectnofollow", path: "/redirect", o: []Option{FollowRedirects(false, 0)}, wantErr: true},
+	{name: "redirectexpected", path: "/redirect", o: []Option{FollowRedirects(false, 0), ExpectedStatus(http.StatusFound)}},
+	{name: "slowwarn", path: "/slow", o: []Option{LatencyThresholds(10*time.Millisecond, 0)}},
+	{name: "slowfail", path: "/slow", o: []Option{LatencyThresholds(0, 10*time.Millisecond)}, wantErr: true},
+}
+
+func TestHTTPCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	srv := httptest.NewServer(testHandler())
+	defer srv.Close()
+
+	for _, tt := range checkTests {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{URL(srv.URL + tt.path), Logger(l)}, tt.o...)
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+	}
+}
+
+func TestHTTPCheckTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(testHandler())
+	defer srv.Close()
+
+	s, _ := statsd.NewNoopClient()
+	for _, skip := range []bool{true, false} {
+		check, err := New("tls", s, URL(srv.URL+"/ok"), InsecureSkipVerify(skip))
+		if err != nil {
+			t.Errorf("New(tls, InsecureSkipVerify(%v)): %v", skip, err)
+			continue
+		}
+		err = check.Check()
+		if skip && err != nil {
+			t.Errorf("InsecureSkipVerify(%v): got %v, did not want error.", skip, err)
+		}
+		if !skip && err == nil {
+			t.Errorf("InsecureSkipVerify(%v): got no error, wanted untrusted certificate to fail", skip)
+		}
+	}
+}
+
+func TestHTTPCheckContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { <-release }))
+	defer srv.Close()
+	defer close(release)
+
+	s, _ := statsd.NewNoopClient()
+	check, err := New("slow", s, URL(srv.URL))
+	if err != nil {
+		t.Fatalf("New(slow): %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	if err := check.(kubernary.ContextChecker).CheckContext(ctx); err == nil {
+		t.Error("check.CheckContext(): want error, got nil")
+	}
+	if took := time.Since(started); took > time.Second {
+		t.Errorf("check.CheckContext(): want return once its context is done, took %s", took)
+	}
+}
+
+func TestHTTPCheckRequiresURL(t *testing.T) {
+	s, _ := statsd.NewNoopClient()
+	if _, err := New("nourl", s); err == nil {
+		t.Error("New(nourl): want error, got nil")
+	}
+}
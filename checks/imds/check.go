@@ -0,0 +1,266 @@
+package imds
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	metricCredentialsSucceeded  string = "credentials.succeeded"
+	metricCredentialsFailed     string = "credentials.failed"
+	metricCredentialsMismatched string = "credentials.mismatched"
+	metricLatency               string = "latency"
+	metricLatencyExceeded       string = "latency.exceeded"
+
+	cfgBaseURL       string = "BASE_URL"
+	cfgRole          string = "ROLE"
+	cfgLatencyBudget string = "LATENCY_BUDGET"
+	cfgIMDSv2        string = "IMDSV2"
+
+	defaultBaseURL       string = "http://169.254.169.254"
+	defaultRole          string = "kubernary"
+	defaultLatencyBudget string = "1s"
+	defaultIMDSv2        string = "true"
+
+	// Requests to the metadata service should never take this long, but we
+	// don't want to hang forever when kube2iam does.
+	defaultClientTimeout = 5 * time.Second
+
+	pathToken       string = "/latest/api/token"
+	pathCredentials string = "/latest/meta-data/iam/security-credentials/"
+
+	headerToken    string = "X-aws-ec2-metadata-token"
+	headerTokenTTL string = "X-aws-ec2-metadata-token-ttl-seconds"
+	tokenTTL       string = "60"
+
+	credentialsCodeSuccess string = "Success"
+)
+
+type check struct {
+	name    string
+	stats   statsd.SubStatter
+	log     *zap.Logger
+	client  *http.Client
+	baseURL string
+	role    string
+	budget  time.Duration
+	v2      bool
+}
+
+// An Option represents an instance metadata service checker option.
+type Option func(*check) error
+
+// HTTPClient allows the use of a bespoke HTTP client.
+func HTTPClient(h *http.Client) Option {
+	return func(c *check) error {
+		c.client = h
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// BaseURL allows the use of a bespoke metadata service URL, for example a
+// local fake metadata service.
+func BaseURL(u string) Option {
+	return func(c *check) error {
+		c.baseURL = strings.TrimSuffix(u, "/")
+		return nil
+	}
+}
+
+// Role sets the IAM role name the metadata service is expected to vend
+// credentials for.
+func Role(r string) Option {
+	return func(c *check) error {
+		c.role = r
+		return nil
+	}
+}
+
+// LatencyBudget sets the longest any one metadata service request may take
+// before the check fails.
+func LatencyBudget(d time.Duration) Option {
+	return func(c *check) error {
+		c.budget = d
+		return nil
+	}
+}
+
+// IMDSv2 determines whether a session token is requested from and presented to
+// the metadata service, per version 2 of the metadata service protocol.
+func IMDSv2(v2 bool) Option {
+	return func(c *check) error {
+		c.v2 = v2
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether the instance metadata service
+// vends credentials for the expected IAM role in a timely fashion.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgBaseURL:       defaultBaseURL,
+		cfgRole:          defaultRole,
+		cfgLatencyBudget: defaultLatencyBudget,
+		cfgIMDSv2:        defaultIMDSv2,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	budget, err := time.ParseDuration(cfg[cfgLatencyBudget])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgLatencyBudget)
+	}
+	v2, err := strconv.ParseBool(cfg[cfgIMDSv2])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgIMDSv2)
+	}
+
+	c := &check{
+		name:    name,
+		stats:   s.NewSubStatter(name),
+		log:     l,
+		client:  &http.Client{Timeout: defaultClientTimeout},
+		baseURL: strings.TrimSuffix(cfg[cfgBaseURL], "/"),
+		role:    cfg[cfgRole],
+		budget:  budget,
+		v2:      v2,
+	}
+
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply instance metadata service Checker option")
+		}
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("baseURL", c.baseURL), zap.String("role", c.role))
+
+	return c, nil
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+// do makes a request to the metadata service, returning the response body and
+// failing if the response does not arrive within the latency budget.
+func (c *check) do(ctx context.Context, method, path, token string) (string, error) {
+	r, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot create %s %s request", method, path)
+	}
+	if method == http.MethodPut {
+		r.Header.Set(headerTokenTTL, tokenTTL)
+	}
+	if token != "" {
+		r.Header.Set(headerToken, token)
+	}
+
+	started := time.Now()
+	rsp, err := c.client.Do(r.WithContext(ctx))
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot %s %s", method, path)
+	}
+	defer rsp.Body.Close()
+	body, err := ioutil.ReadAll(rsp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot read %s %s response body", method, path)
+	}
+	took := time.Since(started)
+
+	if err := c.stats.TimingDuration(metricLatency, took, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metricLatency), zap.Error(err))
+	}
+	if rsp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s %s returned %s", method, path, rsp.Status)
+	}
+	if took > c.budget {
+		c.inc(metricLatencyExceeded)
+		return "", errors.Errorf("%s %s took %s, exceeding latency budget of %s", method, path, took, c.budget)
+	}
+	return string(body), nil
+}
+
+type credentials struct {
+	Code        string
+	AccessKeyID string `json:"AccessKeyId"`
+}
+
+func (c *check) checkCredentials(ctx context.Context) error {
+	token := ""
+	if c.v2 {
+		t, err := c.do(ctx, http.MethodPut, pathToken, "")
+		if err != nil {
+			return errors.Wrap(err, "cannot get session token")
+		}
+		token = t
+	}
+
+	roles, err := c.do(ctx, http.MethodGet, pathCredentials, token)
+	if err != nil {
+		return errors.Wrap(err, "cannot get IAM role")
+	}
+	role := strings.TrimSpace(strings.SplitN(roles, "\n", 2)[0])
+	if role != c.role {
+		c.inc(metricCredentialsMismatched)
+		return errors.Errorf("metadata service vended credentials for role %q, want %q", role, c.role)
+	}
+
+	body, err := c.do(ctx, http.MethodGet, pathCredentials+role, token)
+	if err != nil {
+		return errors.Wrapf(err, "cannot get credentials for role %s", role)
+	}
+	creds := &credentials{}
+	if err := json.Unmarshal([]byte(body), creds); err != nil {
+		return errors.Wrapf(err, "cannot unmarshal credentials for role %s", role)
+	}
+	if creds.Code != credentialsCodeSuccess || creds.AccessKeyID == "" {
+		return errors.Errorf("metadata service returned unusable credentials for role %s: code %q", role, creds.Code)
+	}
+	return nil
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext requests credentials from the metadata service, abandoning
+// any request in flight when the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkCredentials(ctx); err != nil {
+		c.inc(metricCredentialsFailed)
+		c.log.Error("credentials check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s credentials check failed", c.name)
+	}
+	c.inc(metricCredentialsSucceeded)
+	c.log.Debug("credentials check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,122 @@
+package imds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+const testToken string = "sometoken"
+
+type fakeMetadataService struct {
+	role     string
+	code     string
+	delay    time.Duration
+	v2       bool
+	tokenTTL string
+}
+
+func (f *fakeMetadataService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	time.Sleep(f.delay)
+	if r.URL.Path == pathToken {
+		if r.Method != http.MethodPut {
+			http.Error(w, "tokens must be PUT", http.StatusMethodNotAllowed)
+			return
+		}
+		f.tokenTTL = r.Header.Get(headerTokenTTL)
+		fmt.Fprint(w, testToken)
+		return
+	}
+	if f.v2 && r.Header.Get(headerToken) != testToken {
+		http.Error(w, "missing token", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case pathCredentials:
+		fmt.Fprint(w, f.role)
+	case pathCredentials + f.role:
+		fmt.Fprintf(w, `{"Code": %q, "AccessKeyId": "AKIAEXAMPLE"}`, f.code)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var checkTests = []struct {
+	name    string
+	fake    *fakeMetadataService
+	o       []Option
+	wantErr bool
+}{
+	{
+		name: "v2",
+		fake: &fakeMetadataService{role: "kubernary", code: credentialsCodeSuccess, v2: true},
+	},
+	{
+		name: "v1",
+		fake: &fakeMetadataService{role: "kubernary", code: credentialsCodeSuccess},
+		o:    []Option{IMDSv2(false)},
+	},
+	{
+		name:    "v2required",
+		fake:    &fakeMetadataService{role: "kubernary", code: credentialsCodeSuccess, v2: true},
+		o:       []Option{IMDSv2(false)},
+		wantErr: true,
+	},
+	{
+		name:    "noderole",
+		fake:    &fakeMetadataService{role: "nodes", code: credentialsCodeSuccess, v2: true},
+		wantErr: true,
+	},
+	{
+		name:    "badcredentials",
+		fake:    &fakeMetadataService{role: "kubernary", code: "Expired", v2: true},
+		wantErr: true,
+	},
+	{
+		name:    "slow",
+		fake:    &fakeMetadataService{role: "kubernary", code: credentialsCodeSuccess, v2: true, delay: 50 * time.Millisecond},
+		o:       []Option{LatencyBudget(10 * time.Millisecond)},
+		wantErr: true,
+	},
+}
+
+func TestIMDSCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		srv := httptest.NewServer(tt.fake)
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{BaseURL(srv.URL), Logger(l)}, tt.o...)
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			srv.Close()
+			continue
+		}
+
+		err = check.Check()
+		srv.Close()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail", tt.name)
+			continue
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+			continue
+		}
+		if tt.fake.v2 && !tt.wantErr && tt.fake.tokenTTL != tokenTTL {
+			t.Errorf("%s: token TTL header: want %s, got %s", tt.name, tokenTTL, tt.fake.tokenTTL)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package kubeapi
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded string = "succeeded"
+	metricFailed    string = "failed"
+	metricLatency   string = "latency"
+
+	cfgNamespace string = "NAMESPACE"
+	cfgName      string = "NAME"
+	cfgTimeout   string = "TIMEOUT"
+
+	defaultNamespace string = "kubernary"
+	defaultTimeout   string = "5s"
+
+	dataKey string = "ran"
+)
+
+// Verbs exercised by the check. Each is emitted as a distinct metric.
+const (
+	VerbCreate string = "create"
+	VerbGet    string = "get"
+	VerbUpdate string = "update"
+	VerbDelete string = "delete"
+)
+
+// Reasons a verb may fail. Each is emitted as a distinct metric.
+const (
+	ReasonRBAC    string = "rbac"
+	ReasonWebhook string = "webhook"
+	ReasonEtcd    string = "etcd"
+	ReasonTimeout string = "timeout"
+	ReasonOther   string = "other"
+)
+
+type check struct {
+	name      string
+	stats     statsd.SubStatter
+	log       *zap.Logger
+	client    kubernetes.Interface
+	namespace string
+	cmName    string
+	timeout   time.Duration
+}
+
+// An Option represents a Kubernetes API checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Namespace sets the namespace in which the check's ConfigMap is created. The
+// namespace should be dedicated to kubernary.
+func Namespace(ns string) Option {
+	return func(c *check) error {
+		c.namespace = ns
+		return nil
+	}
+}
+
+// ConfigMapName sets the name of the ConfigMap the check creates. It must be
+// unique to each kubernary instance.
+func ConfigMapName(n string) Option {
+	return func(c *check) error {
+		c.cmName = n
+		return nil
+	}
+}
+
+// Timeout sets the longest any one API call may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// defaultName returns a ConfigMap name unique to this kubernary instance, i.e.
+// its pod name.
+func defaultName(check string) string {
+	h, err := os.Hostname()
+	if err != nil || h == "" {
+		h = "unknown"
+	}
+	return strings.ToLower("kubernary-" + check + "-" + h)
+}
+
+// New returns a Checker that checks whether the Kubernetes API server can
+// create, get, update and delete a ConfigMap.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace: defaultNamespace,
+		cfgName:      defaultName(name),
+		cfgTimeout:   defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:      name,
+		stats:     s.NewSubStatter(name),
+		log:       l,
+		namespace: cfg[cfgNamespace],
+		cmName:    cfg[cfgName],
+		timeout:   timeout,
+	}
+
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply Kubernetes API Checker option")
+		}
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("namespace", c.namespace), zap.String("configMap", c.cmName))
+
+	if c.client == nil {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return c, nil
+}
+
+// reason classifies why an API call failed.
+func reason(err error) string {
+	err = errors.Cause(err)
+	msg := err.Error()
+	switch {
+	case kerrors.IsForbidden(err) || kerrors.IsUnauthorized(err):
+		return ReasonRBAC
+	case strings.Contains(msg, "admission webhook"), strings.Contains(msg, "failed calling webhook"):
+		return ReasonWebhook
+	case strings.Contains(msg, "etcdserver"):
+		return ReasonEtcd
+	case kerrors.IsTimeout(err), kerrors.IsServerTimeout(err), timedOut(err):
+		return ReasonTimeout
+	}
+	return ReasonOther
+}
+
+// timedOut returns true if the supplied error is a timeout, including a
+// client-side timeout such as a url.Error wrapping context.DeadlineExceeded.
+func timedOut(err error) bool {
+	t, ok := err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+func (c *check) emit(verb string, took time.Duration, err error) {
+	metric := verb + "." + metricLatency
+	if serr := c.stats.TimingDuration(metric, took, 1.0); serr != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(serr))
+	}
+	metric = verb + "." + metricSucceeded
+	if err != nil {
+		metric = verb + "." + metricFailed + "." + reason(err)
+	}
+	if serr := c.stats.Inc(metric, 1, 1.0); serr != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(serr))
+	}
+}
+
+// do calls fn with a timeout derived from the supplied context, recording its
+// latency and outcome.
+func (c *check) do(ctx context.Context, verb string, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	started := time.Now()
+	err := fn(ctx)
+	c.emit(verb, time.Since(started), err)
+	if err != nil {
+		return errors.Wrapf(err, "cannot %s ConfigMap %s/%s (%s)", verb, c.namespace, c.cmName, reason(err))
+	}
+	return nil
+}
+
+func (c *check) checkRoundTrip(ctx context.Context) (err error) {
+	cms := c.client.CoreV1().ConfigMaps(c.namespace)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      c.cmName,
+			Labels:    map[string]string{"app": "kubernary", "check": c.name},
+		},
+		Data: map[string]string{dataKey: time.Now().UTC().Format(time.RFC3339Nano)},
+	}
+
+	if err := c.do(ctx, VerbCreate, func(ctx context.Context) error {
+		_, err := cms.Create(ctx, cm, metav1.CreateOptions{})
+		if kerrors.IsAlreadyExists(err) {
+			// A previous run failed to clean up after itself.
+			if err := cms.Delete(ctx, c.cmName, metav1.DeleteOptions{}); err != nil {
+				return err
+			}
+			_, err = cms.Create(ctx, cm, metav1.CreateOptions{})
+		}
+		return err
+	}); err != nil {
+		return err
+	}
+	defer func() {
+		// Clean up even if the check has been given up on.
+		derr := c.do(context.Background(), VerbDelete, func(ctx context.Context) error {
+			return cms.Delete(ctx, c.cmName, metav1.DeleteOptions{})
+		})
+		if err == nil {
+			err = derr
+		}
+	}()
+
+	if err := c.do(ctx, VerbGet, func(ctx context.Context) error {
+		got, err := cms.Get(ctx, c.cmName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if got.Data[dataKey] != cm.Data[dataKey] {
+			return errors.Errorf("got %s=%s, want %s", dataKey, got.Data[dataKey], cm.Data[dataKey])
+		}
+		cm = got
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	cm.Data[dataKey] = time.Now().UTC().Format(time.RFC3339Nano)
+	return c.do(ctx, VerbUpdate, func(ctx context.Context) error {
+		_, err := cms.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext round trips a ConfigMap, abandoning any API call in flight when
+// the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkRoundTrip(ctx); err != nil {
+		c.log.Error("round trip check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s round trip check failed", c.name)
+	}
+	c.log.Debug("round trip check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,117 @@
+package kubeapi
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	ktesting "k8s.io/client-go/testing"
+)
+
+var configmaps = schema.GroupResource{Resource: "configmaps"}
+
+func failOn(verb string, err error) ktesting.ReactionFunc {
+	return func(a ktesting.Action) (bool, runtime.Object, error) {
+		if a.GetVerb() != verb {
+			return false, nil, nil
+		}
+		return true, nil, err
+	}
+}
+
+var checkTests = []struct {
+	name       string
+	reactor    ktesting.ReactionFunc
+	existing   bool
+	wantErr    bool
+	wantReason string
+}{
+	{name: "roundtrip"},
+	{name: "leftover", existing: true},
+	{
+		name:       "forbidden",
+		reactor:    failOn(VerbCreate, kerrors.NewForbidden(configmaps, "kubernary", errors.New("RBAC says no"))),
+		wantErr:    true,
+		wantReason: ReasonRBAC,
+	},
+	{
+		name:       "webhook",
+		reactor:    failOn(VerbUpdate, kerrors.NewInternalError(errors.New(`failed calling webhook "nope.example.org"`))),
+		wantErr:    true,
+		wantReason: ReasonWebhook,
+	},
+	{
+		name:       "etcd",
+		reactor:    failOn(VerbGet, kerrors.NewInternalError(errors.New("etcdserver: request timed out"))),
+		wantErr:    true,
+		wantReason: ReasonEtcd,
+	},
+	{
+		name:       "timeout",
+		reactor:    failOn(VerbDelete, kerrors.NewServerTimeout(configmaps, VerbDelete, 1)),
+		wantErr:    true,
+		wantReason: ReasonTimeout,
+	},
+	{
+		name:       "deadline",
+		reactor:    failOn(VerbGet, &url.Error{Op: "Get", URL: "https://kubernetes/api/v1/namespaces/kubernary/configmaps/cm", Err: context.DeadlineExceeded}),
+		wantErr:    true,
+		wantReason: ReasonTimeout,
+	},
+}
+
+func TestKubeAPICheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		k := fake.NewSimpleClientset()
+		if tt.existing {
+			k = fake.NewSimpleClientset(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "kubernary", Name: "cm"}})
+		}
+		if tt.reactor != nil {
+			k.PrependReactor("*", "configmaps", tt.reactor)
+		}
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := []Option{Client(k), Logger(l), Namespace("kubernary"), ConfigMapName("cm"), Timeout(time.Second)}
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted check to fail", tt.name)
+				continue
+			}
+			if got := reason(err); got != tt.wantReason {
+				t.Errorf("%s: reason(%v): want %s, got %s", tt.name, err, tt.wantReason, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+			continue
+		}
+		if _, err := k.CoreV1().ConfigMaps("kubernary").Get(context.Background(), "cm", metav1.GetOptions{}); !kerrors.IsNotFound(err) {
+			t.Errorf("%s: want ConfigMap to be deleted, got %v", tt.name, err)
+		}
+	}
+}
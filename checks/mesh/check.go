@@ -0,0 +1,366 @@
+package mesh
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded string = "succeeded"
+	metricFailed    string = "failed"
+	metricLatency   string = "latency"
+	metricPeers     string = "peers"
+
+	cfgNamespace string = "NAMESPACE"
+	cfgService   string = "SERVICE"
+	cfgPort      string = "PORT"
+	cfgPath      string = "PATH"
+	cfgTimeout   string = "TIMEOUT"
+
+	defaultNamespace string = "kubernary"
+	defaultService   string = "kubernary"
+	defaultPort      string = "10002"
+	defaultPath      string = "/ping"
+	defaultTimeout   string = "1s"
+)
+
+// A Probe is the result of probing a peer.
+type Probe struct {
+	kube.Peer
+	OK        bool          `json:"ok"`
+	Error     string        `json:"error"`
+	Latency   time.Duration `json:"latency"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// A Matrix maps each source node to the results of probing the peers on each
+// destination node.
+type Matrix map[string]map[string]*Probe
+
+type check struct {
+	name      string
+	stats     statsd.SubStatter
+	log       *zap.Logger
+	client    kubernetes.Interface
+	http      *http.Client
+	namespace string
+	service   string
+	port      string
+	path      string
+	pod       string
+	timeout   time.Duration
+
+	m      sync.RWMutex
+	self   kube.Peer
+	probes map[string]*Probe
+}
+
+// An Option represents a mesh checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// HTTPClient allows the use of a bespoke HTTP client.
+func HTTPClient(h *http.Client) Option {
+	return func(c *check) error {
+		c.http = h
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Service sets the namespace and name of the headless Service that selects all
+// kubernary pods.
+func Service(namespace, name string) Option {
+	return func(c *check) error {
+		c.namespace = namespace
+		c.service = name
+		return nil
+	}
+}
+
+// Port sets the port at which peers serve HTTP.
+func Port(p string) Option {
+	return func(c *check) error {
+		c.port = p
+		return nil
+	}
+}
+
+// Pod sets the name of this kubernary instance's pod, which is excluded from
+// its peers. Defaults to the hostname.
+func Pod(p string) Option {
+	return func(c *check) error {
+		c.pod = p
+		return nil
+	}
+}
+
+// Timeout sets the longest probing any one peer may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether every peer kubernary instance is
+// reachable over HTTP. The Checker is a kubernary.HandlerChecker; its handler
+// serves the most recent reachability matrix.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace: defaultNamespace,
+		cfgService:   defaultService,
+		cfgPort:      defaultPort,
+		cfgPath:      defaultPath,
+		cfgTimeout:   defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+	pod, _ := os.Hostname() // nolint: gas
+
+	c := &check{
+		name:      name,
+		stats:     s.NewSubStatter(name),
+		log:       l,
+		namespace: cfg[cfgNamespace],
+		service:   cfg[cfgService],
+		port:      cfg[cfgPort],
+		path:      cfg[cfgPath],
+		pod:       pod,
+		timeout:   timeout,
+		self:      kube.Peer{Node: kube.Unknown, Zone: kube.Unknown},
+		probes:    map[string]*Probe{},
+	}
+
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply mesh Checker option")
+		}
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("pod", c.pod))
+
+	if c.http == nil {
+		c.http = &http.Client{Timeout: c.timeout}
+	}
+	if c.client == nil {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return c, nil
+}
+
+// peers returns this kubernary instance, and every other ready kubernary
+// instance.
+func (c *check) peers(ctx context.Context) (kube.Peer, []kube.Peer, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	all, err := kube.Peers(ctx, c.client, c.namespace, c.service)
+	if err != nil {
+		return kube.Peer{}, nil, errors.Wrap(err, "cannot list peers")
+	}
+
+	self, peers := kube.Peer{Pod: c.pod, Node: kube.Unknown, Zone: kube.Unknown}, make([]kube.Peer, 0, len(all))
+	for _, p := range all {
+		if p.Pod == c.pod {
+			self = p
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return self, peers, nil
+}
+
+func (c *check) probe(ctx context.Context, p kube.Peer) *Probe {
+	pr := &Probe{Peer: p, CheckedAt: time.Now()}
+	u := "http://" + net.JoinHostPort(p.Address, c.port) + c.path
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		pr.Error = err.Error()
+		return pr
+	}
+	rsp, err := c.http.Do(req.WithContext(ctx))
+	pr.Latency = time.Since(pr.CheckedAt)
+	if err != nil {
+		pr.Error = err.Error()
+		return pr
+	}
+	defer rsp.Body.Close()
+	ioutil.ReadAll(rsp.Body) // nolint: gas,errcheck
+	if rsp.StatusCode != http.StatusOK {
+		pr.Error = "GET " + u + " returned " + rsp.Status
+		return pr
+	}
+	pr.OK = true
+	return pr
+}
+
+// metricName converts a zone name into a single statsd metric path component.
+func metricName(z string) string {
+	return strings.Replace(z, ".", "_", -1)
+}
+
+// emit emits metrics for a probe keyed by source and destination zone, rather
+// than node, so that the number of distinct metrics doesn't grow with the
+// square of the number of nodes.
+func (c *check) emit(from kube.Peer, pr *Probe) {
+	prefix := metricName(from.Zone) + "." + metricName(pr.Zone) + "."
+	metric := prefix + metricLatency
+	if err := c.stats.TimingDuration(metric, pr.Latency, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+	metric = prefix + metricSucceeded
+	if !pr.OK {
+		metric = prefix + metricFailed
+	}
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) checkPeers(ctx context.Context) error {
+	self, peers, err := c.peers(ctx)
+	if err != nil {
+		return errors.Wrap(err, "cannot discover peers")
+	}
+	if err := c.stats.Gauge(metricPeers, int64(len(peers)), 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metricPeers), zap.Error(err))
+	}
+
+	probes := make(chan *Probe, len(peers))
+	wg := &sync.WaitGroup{}
+	for _, p := range peers {
+		wg.Add(1)
+		go func(p kube.Peer) {
+			defer wg.Done()
+			probes <- c.probe(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+	close(probes)
+
+	latest := map[string]*Probe{}
+	failures := []string{}
+	for pr := range probes {
+		c.emit(self, pr)
+		latest[pr.Pod] = pr
+		if !pr.OK {
+			failures = append(failures, pr.Pod+" on "+pr.Node+": "+pr.Error)
+		}
+	}
+
+	c.m.Lock()
+	c.self, c.probes = self, latest
+	c.m.Unlock()
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		return errors.Errorf("%d of %d peers unreachable from %s: %s", len(failures), len(peers), self.Node, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// Matrix returns the results of the most recent probe of each peer, keyed by
+// this instance's node and each peer's node. When a node runs multiple peers
+// its cell is the most recent failed probe of any of them, or the most recent
+// probe if none failed.
+func (c *check) Matrix() Matrix {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	row := map[string]*Probe{}
+	for _, pr := range c.probes {
+		if existing, ok := row[pr.Node]; ok && !supersedes(pr, existing) {
+			continue
+		}
+		row[pr.Node] = pr
+	}
+	return Matrix{c.self.Node: row}
+}
+
+// supersedes returns true if probe a should be shown in place of probe b.
+func supersedes(a, b *Probe) bool {
+	if a.OK != b.OK {
+		return !a.OK
+	}
+	return a.CheckedAt.After(b.CheckedAt)
+}
+
+// Handler returns an HTTP handler that serves the most recent reachability
+// matrix as JSON.
+func (c *check) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		j, err := json.Marshal(c.Matrix())
+		if err != nil {
+			http.Error(w, errors.Wrap(err, "cannot marshal reachability matrix").Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(j) // nolint: gas,errcheck
+	}
+}
+
+// Check probes every peer kubernary instance.
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext probes every peer kubernary instance, abandoning any probe in
+// flight when the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkPeers(ctx); err != nil {
+		c.log.Error("mesh check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s mesh check failed", c.name)
+	}
+	c.log.Debug("mesh check succeeded")
+	return nil
+}
+
+// Name returns the name of the check.
+func (c *check) Name() string {
+	return c.name
+}
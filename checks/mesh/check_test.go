@@ -0,0 +1,211 @@
+package mesh
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// predictableTransport fails to reach any host in its broken set, and
+// successfully pings all others.
+type predictableTransport struct {
+	broken map[string]bool
+}
+
+func (t *predictableTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.broken[r.URL.Hostname()] {
+		return nil, errors.Errorf("cannot connect to %s", r.URL.Host)
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Body:       ioutil.NopCloser(strings.NewReader(`{"ok":true,"error":""}`)),
+		Request:    r,
+	}, nil
+}
+
+// recordingSender records the statsd metrics it is asked to send.
+type recordingSender struct {
+	m       sync.Mutex
+	metrics []string
+}
+
+func (s *recordingSender) Send(data []byte) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.metrics = append(s.metrics, string(data))
+	return len(data), nil
+}
+
+func (s *recordingSender) Close() error {
+	return nil
+}
+
+func endpoint(pod, node, zone, addr string) discoveryv1.Endpoint {
+	ready := true
+	return discoveryv1.Endpoint{
+		Addresses:  []string{addr},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		NodeName:   &node,
+		Zone:       &zone,
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod},
+	}
+}
+
+func matrix(c kubernary.Checker) Matrix {
+	return c.(*check).Matrix()
+}
+
+func slice() *discoveryv1.EndpointSlice {
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: defaultNamespace,
+			Name:      "kubernary-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: defaultService},
+		},
+		Endpoints: []discoveryv1.Endpoint{
+			endpoint("kubernary-a", "node-a.example.org", "zone-a", "10.0.0.1"),
+			endpoint("kubernary-b", "node-b.example.org", "zone-a", "10.0.0.2"),
+			endpoint("kubernary-c", "node-c.example.org", "zone-b", "10.0.0.3"),
+		},
+	}
+}
+
+var checkTests = []struct {
+	name    string
+	broken  map[string]bool
+	wantErr bool
+}{
+	{name: "ok"},
+	{name: "unreachable", broken: map[string]bool{"10.0.0.3": true}, wantErr: true},
+	{name: "self", broken: map[string]bool{"10.0.0.1": true}},
+}
+
+func TestMeshCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		s, _ := statsd.NewNoopClient()
+		h := &http.Client{Transport: &predictableTransport{broken: tt.broken}}
+		m, err := New(tt.name, s, Client(fake.NewSimpleClientset(slice())), HTTPClient(h), Pod("kubernary-a"), Logger(l))
+		if err != nil {
+			t.Errorf("%s: New(): %v", tt.name, err)
+			continue
+		}
+		err = m.Check()
+		if tt.wantErr != (err != nil) {
+			t.Errorf("%s: m.Check(): want error %v, got %v", tt.name, tt.wantErr, err)
+		}
+
+		row, ok := matrix(m)["node-a.example.org"]
+		if !ok {
+			t.Errorf("%s: matrix(m): want row for node-a.example.org, got %v", tt.name, matrix(m))
+			continue
+		}
+		if len(row) != 2 {
+			t.Errorf("%s: matrix(m): want 2 peers, got %d", tt.name, len(row))
+		}
+		for node, pr := range row {
+			want := !tt.broken[pr.Address]
+			if pr.OK != want {
+				t.Errorf("%s: matrix(m)[%s].OK: want %v, got %v", tt.name, node, want, pr.OK)
+			}
+		}
+	}
+}
+
+func TestMeshMatrixMultiplePeersPerNode(t *testing.T) {
+	es := slice()
+	es.Endpoints = append(es.Endpoints, endpoint("kubernary-d", "node-c.example.org", "zone-b", "10.0.0.4"))
+
+	for _, broken := range []string{"10.0.0.3", "10.0.0.4"} {
+		s, _ := statsd.NewNoopClient()
+		h := &http.Client{Transport: &predictableTransport{broken: map[string]bool{broken: true}}}
+		m, err := New("multiple", s, Client(fake.NewSimpleClientset(es)), HTTPClient(h), Pod("kubernary-a"))
+		if err != nil {
+			t.Fatalf("New(): %v", err)
+		}
+		if err := m.Check(); err == nil {
+			t.Errorf("%s broken: m.Check(): want error, got nil", broken)
+		}
+		pr, ok := matrix(m)["node-a.example.org"]["node-c.example.org"]
+		if !ok {
+			t.Errorf("%s broken: matrix(m): want cell for node-c.example.org, got %v", broken, matrix(m))
+			continue
+		}
+		if pr.OK {
+			t.Errorf("%s broken: matrix(m)[node-c.example.org].OK: want false, got true", broken)
+		}
+	}
+}
+
+func TestMeshHandler(t *testing.T) {
+	s, _ := statsd.NewNoopClient()
+	h := &http.Client{Transport: &predictableTransport{}}
+	m, err := New("handler", s, Client(fake.NewSimpleClientset(slice())), HTTPClient(h), Pod("kubernary-a"))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if err := m.Check(); err != nil {
+		t.Fatalf("m.Check(): %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	hc, ok := m.(kubernary.HandlerChecker)
+	if !ok {
+		t.Fatal("New(): want kubernary.HandlerChecker")
+	}
+	hc.Handler()(w, httptest.NewRequest("GET", "/mesh", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("m.Handler(): want status %d, got %d", http.StatusOK, w.Code)
+	}
+	got := Matrix{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	if !got["node-a.example.org"]["node-b.example.org"].OK {
+		t.Errorf("m.Handler(): want node-a.example.org to reach node-b.example.org, got %v", got)
+	}
+}
+
+func TestMeshMetricsByZone(t *testing.T) {
+	rs := &recordingSender{}
+	s, err := statsd.NewClientWithSender(rs, "")
+	if err != nil {
+		t.Fatalf("statsd.NewClientWithSender(): %v", err)
+	}
+	h := &http.Client{Transport: &predictableTransport{broken: map[string]bool{"10.0.0.3": true}}}
+	m, err := New("mesh", s, Client(fake.NewSimpleClientset(slice())), HTTPClient(h), Pod("kubernary-a"))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	m.Check() // nolint: errcheck
+
+	want := []string{"mesh.zone-a.zone-a.succeeded:1|c", "mesh.zone-a.zone-b.failed:1|c"}
+	got := strings.Join(rs.metrics, "\n")
+	for _, metric := range want {
+		if !strings.Contains(got, metric) {
+			t.Errorf("m.Check(): want metric %s, got %v", metric, rs.metrics)
+		}
+	}
+	if strings.Contains(got, "node-") {
+		t.Errorf("m.Check(): want no per node metrics, got %v", rs.metrics)
+	}
+}
@@ -0,0 +1,423 @@
+package podlaunch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded string = "succeeded"
+	metricFailed    string = "failed"
+	metricLatency   string = "latency"
+
+	cfgNamespace    string = "NAMESPACE"
+	cfgImage        string = "IMAGE"
+	cfgCommand      string = "COMMAND"
+	cfgNodeSelector string = "NODE_SELECTOR"
+	cfgTolerations  string = "TOLERATIONS"
+	cfgTimeout      string = "TIMEOUT"
+
+	defaultNamespace    string = "kubernary"
+	defaultImage        string = "busybox"
+	defaultCommand      string = "true"
+	defaultNodeSelector string = ""
+	defaultTolerations  string = ""
+	defaultTimeout      string = "2m"
+
+	// Deleting the pod should never take this long, but we don't want to hang
+	// forever if the API server does.
+	cleanupTimeout = 30 * time.Second
+)
+
+// Phases through which the check's pod is expected to progress, in order.
+// Each phase's latency is emitted as a distinct metric.
+const (
+	PhaseScheduled       string = "scheduled"
+	PhaseContainersReady string = "containersready"
+	PhaseSucceeded       string = "succeeded"
+)
+
+var phases = []string{PhaseScheduled, PhaseContainersReady, PhaseSucceeded}
+
+type check struct {
+	name         string
+	stats        statsd.SubStatter
+	log          *zap.Logger
+	client       kubernetes.Interface
+	namespace    string
+	image        string
+	command      []string
+	nodeSelector map[string]string
+	tolerations  []corev1.Toleration
+	timeout      time.Duration
+}
+
+// An Option represents a pod launch checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Namespace sets the namespace in which the check's pod is launched.
+func Namespace(ns string) Option {
+	return func(c *check) error {
+		c.namespace = ns
+		return nil
+	}
+}
+
+// Image sets the container image the check's pod runs.
+func Image(i string) Option {
+	return func(c *check) error {
+		c.image = i
+		return nil
+	}
+}
+
+// Command sets the command the check's pod runs. It should exit zero quickly.
+func Command(cmd ...string) Option {
+	return func(c *check) error {
+		c.command = cmd
+		return nil
+	}
+}
+
+// NodeSelector adds a node selector to the check's pod.
+func NodeSelector(k, v string) Option {
+	return func(c *check) error {
+		c.nodeSelector[k] = v
+		return nil
+	}
+}
+
+// Toleration adds a toleration to the check's pod.
+func Toleration(t corev1.Toleration) Option {
+	return func(c *check) error {
+		c.tolerations = append(c.tolerations, t)
+		return nil
+	}
+}
+
+// Timeout sets the longest the check's pod may take to succeed.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// parseToleration parses a toleration of the form key=value:Effect. The value
+// and effect are optional; a toleration without a value tolerates any value.
+func parseToleration(v string) corev1.Toleration {
+	t := corev1.Toleration{Operator: corev1.TolerationOpExists}
+	if i := strings.LastIndex(v, ":"); i >= 0 {
+		t.Effect = corev1.TaintEffect(v[i+1:])
+		v = v[:i]
+	}
+	if i := strings.Index(v, "="); i >= 0 {
+		t.Operator = corev1.TolerationOpEqual
+		t.Value = v[i+1:]
+		v = v[:i]
+	}
+	t.Key = v
+	return t
+}
+
+// New returns a Checker that checks whether a pod can be scheduled, started,
+// and run to completion.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace:    defaultNamespace,
+		cfgImage:        defaultImage,
+		cfgCommand:      defaultCommand,
+		cfgNodeSelector: defaultNodeSelector,
+		cfgTolerations:  defaultTolerations,
+		cfgTimeout:      defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:         name,
+		stats:        s.NewSubStatter(name),
+		log:          l,
+		namespace:    cfg[cfgNamespace],
+		image:        cfg[cfgImage],
+		command:      strings.Fields(cfg[cfgCommand]),
+		nodeSelector: map[string]string{},
+		timeout:      timeout,
+	}
+
+	env := []Option{}
+	for _, ns := range kubernary.SplitConfigValue(cfg[cfgNodeSelector]) {
+		kv := strings.SplitN(ns, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("cannot parse %s: %s is not of the form key=value", cfgNodeSelector, ns)
+		}
+		env = append(env, NodeSelector(kv[0], kv[1]))
+	}
+	for _, t := range kubernary.SplitConfigValue(cfg[cfgTolerations]) {
+		env = append(env, Toleration(parseToleration(t)))
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply pod launch Checker option")
+		}
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("namespace", c.namespace), zap.String("image", c.image))
+
+	if c.client == nil {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return c, nil
+}
+
+func (c *check) pod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: c.namespace,
+			Name:      fmt.Sprintf("kubernary-%s-%s", c.name, rand.String(5)),
+			Labels:    map[string]string{"app": "kubernary", "check": c.name},
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			NodeSelector:                  c.nodeSelector,
+			Tolerations:                   c.tolerations,
+			TerminationGracePeriodSeconds: new(int64),
+			AutomountServiceAccountToken:  new(bool),
+			Containers: []corev1.Container{{
+				Name:            "launch",
+				Image:           c.image,
+				Command:         c.command,
+				ImagePullPolicy: corev1.PullIfNotPresent,
+			}},
+		},
+	}
+}
+
+func conditionTrue(p *corev1.Pod, t corev1.PodConditionType) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == t && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// containersStarted returns true if all of the pod's containers have started.
+// Short lived containers may exit before their pod is observed to be ready.
+func containersStarted(p *corev1.Pod) bool {
+	if len(p.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, s := range p.Status.ContainerStatuses {
+		if s.State.Running == nil && s.State.Terminated == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// reached returns the phases the supplied pod has reached.
+func reached(p *corev1.Pod) map[string]bool {
+	return map[string]bool{
+		PhaseScheduled:       conditionTrue(p, corev1.PodScheduled),
+		PhaseContainersReady: conditionTrue(p, corev1.ContainersReady) || containersStarted(p),
+		PhaseSucceeded:       p.Status.Phase == corev1.PodSucceeded,
+	}
+}
+
+// stuck returns the first phase the supplied latencies do not include.
+func stuck(latencies map[string]time.Duration) string {
+	for _, phase := range phases {
+		if _, ok := latencies[phase]; !ok {
+			return phase
+		}
+	}
+	return ""
+}
+
+// why explains why the supplied pod may be stuck, using its container statuses
+// and most recent event.
+func (c *check) why(p *corev1.Pod) string {
+	reasons := []string{}
+	for _, s := range p.Status.ContainerStatuses {
+		if w := s.State.Waiting; w != nil && w.Reason != "" {
+			reasons = append(reasons, fmt.Sprintf("container %s is waiting: %s %s", s.Name, w.Reason, w.Message))
+		}
+		if t := s.State.Terminated; t != nil && t.ExitCode != 0 {
+			reasons = append(reasons, fmt.Sprintf("container %s exited %d: %s %s", s.Name, t.ExitCode, t.Reason, t.Message))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	sel := fields.OneTermEqualSelector("involvedObject.name", p.GetName()).String()
+	events, err := c.client.CoreV1().Events(c.namespace).List(ctx, metav1.ListOptions{FieldSelector: sel})
+	if err != nil {
+		c.log.Error("cannot list pod events", zap.String("pod", p.GetName()), zap.Error(err))
+	}
+	if err == nil {
+		evts := []corev1.Event{}
+		for _, e := range events.Items {
+			if e.InvolvedObject.Name == p.GetName() {
+				evts = append(evts, e)
+			}
+		}
+		sort.Slice(evts, func(i, j int) bool { return evts[i].LastTimestamp.Before(&evts[j].LastTimestamp) })
+		if len(evts) > 0 {
+			e := evts[len(evts)-1]
+			reasons = append(reasons, fmt.Sprintf("last event: %s %s", e.Reason, e.Message))
+		}
+	}
+
+	if len(reasons) == 0 {
+		return "no events"
+	}
+	return strings.Join(reasons, "; ")
+}
+
+func (c *check) timing(phase string, d time.Duration) {
+	metric := phase + "." + metricLatency
+	if err := c.stats.TimingDuration(metric, d, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) cleanup(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	if err := c.client.CoreV1().Pods(c.namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: new(int64)}); err != nil {
+		c.log.Error("cannot delete pod", zap.String("pod", name), zap.Error(err))
+	}
+}
+
+func (c *check) checkLaunch(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	p := c.pod()
+	pods := c.client.CoreV1().Pods(c.namespace)
+
+	// Watch before creating so we cannot miss any updates.
+	sel := fields.OneTermEqualSelector("metadata.name", p.GetName()).String()
+	w, err := pods.Watch(ctx, metav1.ListOptions{FieldSelector: sel})
+	if err != nil {
+		return errors.Wrap(err, "cannot watch pods")
+	}
+	defer w.Stop()
+
+	started := time.Now()
+	if _, err := pods.Create(ctx, p, metav1.CreateOptions{}); err != nil {
+		return errors.Wrapf(err, "cannot create pod %s", p.GetName())
+	}
+	defer c.cleanup(p.GetName())
+
+	latencies := map[string]time.Duration{}
+	for {
+		select {
+		case <-ctx.Done():
+			phase := stuck(latencies)
+			c.inc(metricFailed + "." + phase)
+			return errors.Errorf("pod %s stuck before %s after %s: %s", p.GetName(), phase, time.Since(started), c.why(p))
+		case e, ok := <-w.ResultChan():
+			if !ok {
+				return errors.Errorf("watch of pod %s closed unexpectedly", p.GetName())
+			}
+			if e.Type == watch.Error {
+				return errors.Errorf("watch of pod %s failed: %v", p.GetName(), e.Object)
+			}
+			observed, ok := e.Object.(*corev1.Pod)
+			if !ok || e.Type == watch.Deleted {
+				continue
+			}
+			p = observed
+			r := reached(p)
+			for _, phase := range phases {
+				if _, done := latencies[phase]; r[phase] && !done {
+					latencies[phase] = time.Since(started)
+					c.timing(phase, latencies[phase])
+				}
+			}
+			if p.Status.Phase == corev1.PodFailed {
+				phase := stuck(latencies)
+				c.inc(metricFailed + "." + phase)
+				return errors.Errorf("pod %s failed before %s: %s", p.GetName(), phase, c.why(p))
+			}
+			if r[PhaseSucceeded] {
+				c.inc(metricSucceeded)
+				c.log.Debug("pod launched", zap.String("pod", p.GetName()), zap.Any("latencies", latencies))
+				return nil
+			}
+		}
+	}
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext launches a pod, giving up when the supplied context is done.
+// The pod is deleted regardless.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkLaunch(ctx); err != nil {
+		c.log.Error("launch check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s launch check failed", c.name)
+	}
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
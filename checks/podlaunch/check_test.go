@@ -0,0 +1,155 @@
+package podlaunch
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace string = "kubernary"
+
+// waitForPod returns the first pod created in the test namespace.
+func waitForPod(t *testing.T, k kubernetes.Interface) *corev1.Pod {
+	for {
+		l, err := k.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Errorf("List(): %v", err)
+			return nil
+		}
+		if len(l.Items) > 0 {
+			return &l.Items[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// kubelet pretends to be the scheduler and kubelet, progressing the first pod
+// it sees through the supplied statuses.
+func kubelet(t *testing.T, k kubernetes.Interface, statuses ...corev1.PodStatus) {
+	p := waitForPod(t, k)
+	for _, s := range statuses {
+		p.Status = s
+		u, err := k.CoreV1().Pods(testNamespace).UpdateStatus(context.Background(), p, metav1.UpdateOptions{})
+		if err != nil {
+			t.Errorf("UpdateStatus(): %v", err)
+			return
+		}
+		p = u
+	}
+}
+
+var (
+	scheduled = corev1.PodStatus{
+		Phase:      corev1.PodPending,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+	}
+	pulling = corev1.PodStatus{
+		Phase:      corev1.PodPending,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "launch",
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff"}},
+		}},
+	}
+	running = corev1.PodStatus{
+		Phase: corev1.PodRunning,
+		Conditions: []corev1.PodCondition{
+			{Type: corev1.PodScheduled, Status: corev1.ConditionTrue},
+			{Type: corev1.ContainersReady, Status: corev1.ConditionTrue},
+		},
+	}
+	succeeded = corev1.PodStatus{
+		Phase:      corev1.PodSucceeded,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "launch",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+		}},
+	}
+	failed = corev1.PodStatus{
+		Phase:      corev1.PodFailed,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "launch",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}},
+		}},
+	}
+)
+
+var checkTests = []struct {
+	name      string
+	statuses  []corev1.PodStatus
+	wantErr   bool
+	wantStuck string
+}{
+	{name: "succeeded", statuses: []corev1.PodStatus{scheduled, running, succeeded}},
+	{name: "quick", statuses: []corev1.PodStatus{scheduled, succeeded}},
+	{name: "unschedulable", wantErr: true, wantStuck: PhaseScheduled},
+	{name: "imagepull", statuses: []corev1.PodStatus{pulling}, wantErr: true, wantStuck: PhaseContainersReady},
+	{name: "failed", statuses: []corev1.PodStatus{scheduled, failed}, wantErr: true, wantStuck: PhaseSucceeded},
+}
+
+func TestPodLaunchCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		k := fake.NewSimpleClientset()
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := []Option{Client(k), Logger(l), Namespace(testNamespace), Timeout(200 * time.Millisecond)}
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		go kubelet(t, k, tt.statuses...)
+		err = check.Check()
+
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted check to fail", tt.name)
+			} else if !strings.Contains(err.Error(), "before "+tt.wantStuck) {
+				t.Errorf("%s: want error naming stuck phase %s, got %v", tt.name, tt.wantStuck, err)
+			}
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+
+		pods, err := k.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Errorf("%s: List(): %v", tt.name, err)
+			continue
+		}
+		if len(pods.Items) > 0 {
+			t.Errorf("%s: want pod to be cleaned up, found %d pods", tt.name, len(pods.Items))
+		}
+	}
+}
+
+func TestParseToleration(t *testing.T) {
+	cases := map[string]corev1.Toleration{
+		"dedicated=canary:NoSchedule": {Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "canary", Effect: corev1.TaintEffectNoSchedule},
+		"dedicated:NoExecute":         {Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute},
+		"dedicated=canary":            {Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "canary"},
+	}
+	for v, want := range cases {
+		if got := parseToleration(v); got != want {
+			t.Errorf("parseToleration(%v): want %+v, got %+v", v, want, got)
+		}
+	}
+}
@@ -0,0 +1,517 @@
+package pvc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded string = "succeeded"
+	metricFailed    string = "failed"
+	metricLatency   string = "latency"
+
+	cfgNamespace    string = "NAMESPACE"
+	cfgStorageClass string = "STORAGE_CLASS"
+	cfgSize         string = "SIZE"
+	cfgMount        string = "MOUNT"
+	cfgImage        string = "IMAGE"
+	cfgTimeout      string = "TIMEOUT"
+
+	cfgPodName      string = "NAME"
+	cfgPodNamespace string = "NAMESPACE"
+	cfgPodUID       string = "UID"
+
+	defaultNamespace    string = "kubernary"
+	defaultStorageClass string = ""
+	defaultSize         string = "1Gi"
+	defaultMount        string = "true"
+	defaultImage        string = "busybox"
+	defaultTimeout      string = "5m"
+
+	// Deleting should never take this long, but we don't want to hang forever
+	// if the API server does.
+	cleanupTimeout = 30 * time.Second
+
+	defaultPollInterval = 1 * time.Second
+
+	mountPath string = "/data"
+)
+
+// Stages through which the check progresses, in order. Each stage's latency
+// and failures are emitted as distinct metrics.
+const (
+	StageBind      string = "bind"
+	StageAttach    string = "attach"
+	StageReadWrite string = "readwrite"
+)
+
+type check struct {
+	name         string
+	stats        statsd.SubStatter
+	log          *zap.Logger
+	client       kubernetes.Interface
+	namespace    string
+	storageClass string
+	size         resource.Quantity
+	mount        bool
+	image        string
+	timeout      time.Duration
+	poll         time.Duration
+	instance     string
+	owner        *metav1.OwnerReference
+}
+
+// An Option represents a persistent volume checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Namespace sets the namespace in which the check's PersistentVolumeClaim and
+// pod are created. The namespace should be dedicated to kubernary.
+func Namespace(ns string) Option {
+	return func(c *check) error {
+		c.namespace = ns
+		return nil
+	}
+}
+
+// StorageClass sets the StorageClass from which to provision a volume. The
+// cluster's default StorageClass is used if none is set.
+func StorageClass(sc string) Option {
+	return func(c *check) error {
+		c.storageClass = sc
+		return nil
+	}
+}
+
+// Size sets the size of the PersistentVolumeClaim, e.g. 1Gi.
+func Size(s string) Option {
+	return func(c *check) error {
+		q, err := resource.ParseQuantity(s)
+		if err != nil {
+			return errors.Wrapf(err, "cannot parse size %s", s)
+		}
+		c.size = q
+		return nil
+	}
+}
+
+// Mount determines whether the provisioned volume is mounted by a pod that
+// writes to and reads from it. The claim of a StorageClass that waits for its
+// first consumer will never be bound unless it is mounted.
+func Mount(m bool) Option {
+	return func(c *check) error {
+		c.mount = m
+		return nil
+	}
+}
+
+// Image sets the container image of the pod that mounts the volume. The image
+// must include a shell.
+func Image(i string) Option {
+	return func(c *check) error {
+		c.image = i
+		return nil
+	}
+}
+
+// Instance identifies this kubernary. Claims and pods are labelled with the
+// instance that created them, and only this instance's orphans are deleted.
+// Defaults to the UID of kubernary's pod, or its pod name if the UID is
+// unknown.
+func Instance(id string) Option {
+	return func(c *check) error {
+		c.instance = id
+		return nil
+	}
+}
+
+// Owner sets the pod that owns the check's claims and pods, which Kubernetes
+// garbage collects when the owner is deleted. The owner must run in the
+// check's namespace. Defaults to kubernary's pod, if its UID is known and it
+// runs in the check's namespace.
+func Owner(name, uid string) Option {
+	return func(c *check) error {
+		c.owner = &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: name, UID: types.UID(uid)}
+		return nil
+	}
+}
+
+// Timeout sets the longest the check may take to bind, attach, write to and
+// read from a volume.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether a PersistentVolumeClaim can be
+// provisioned, bound and, optionally, mounted, written to and read from.
+// PersistentVolumeClaims and pods orphaned by previous runs are deleted.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace:    defaultNamespace,
+		cfgStorageClass: defaultStorageClass,
+		cfgSize:         defaultSize,
+		cfgMount:        defaultMount,
+		cfgImage:        defaultImage,
+		cfgTimeout:      defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	mount, err := strconv.ParseBool(cfg[cfgMount])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgMount)
+	}
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:         name,
+		stats:        s.NewSubStatter(name),
+		log:          l,
+		namespace:    cfg[cfgNamespace],
+		storageClass: cfg[cfgStorageClass],
+		mount:        mount,
+		image:        cfg[cfgImage],
+		timeout:      timeout,
+		poll:         defaultPollInterval,
+	}
+
+	for _, o := range append([]Option{Size(cfg[cfgSize])}, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply persistent volume Checker option")
+		}
+	}
+
+	// An owner in another namespace would cause the check's claims and pods
+	// to be garbage collected as soon as they were created.
+	hostname, _ := os.Hostname() // nolint: gas
+	pod := kubernary.CheckConfigFromEnv("pod", map[string]string{cfgPodName: hostname, cfgPodNamespace: "", cfgPodUID: ""})
+	if c.owner == nil && pod[cfgPodUID] != "" && pod[cfgPodNamespace] == c.namespace {
+		c.owner = &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: pod[cfgPodName], UID: types.UID(pod[cfgPodUID])}
+	}
+	if c.instance == "" {
+		c.instance = pod[cfgPodUID]
+	}
+	if c.instance == "" {
+		c.instance = pod[cfgPodName]
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("namespace", c.namespace), zap.String("storageClass", c.storageClass))
+
+	if c.client == nil {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	c.cleanupOrphans()
+
+	return c, nil
+}
+
+func (c *check) labels() map[string]string {
+	return map[string]string{"app": "kubernary", "check": c.name, "instance": c.instance}
+}
+
+func (c *check) meta(name string) metav1.ObjectMeta {
+	m := metav1.ObjectMeta{Namespace: c.namespace, Name: name, Labels: c.labels()}
+	if c.owner != nil {
+		m.OwnerReferences = []metav1.OwnerReference{*c.owner}
+	}
+	return m
+}
+
+// cleanupOrphans deletes any pods and PersistentVolumeClaims left behind by
+// previous runs of this instance, for example due to kubernary being killed
+// mid-check. Other instances sharing the namespace may be mid-check.
+func (c *check) cleanupOrphans() {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	sel := metav1.ListOptions{LabelSelector: labels.SelectorFromSet(c.labels()).String()}
+
+	pods, err := c.client.CoreV1().Pods(c.namespace).List(ctx, sel)
+	if err != nil {
+		c.log.Error("cannot list orphaned pods", zap.Error(err))
+	}
+	if err == nil {
+		for _, p := range pods.Items {
+			c.log.Info("deleting orphaned pod", zap.String("pod", p.GetName()))
+			c.deletePod(p.GetName())
+		}
+	}
+
+	pvcs, err := c.client.CoreV1().PersistentVolumeClaims(c.namespace).List(ctx, sel)
+	if err != nil {
+		c.log.Error("cannot list orphaned persistent volume claims", zap.Error(err))
+		return
+	}
+	for _, pvc := range pvcs.Items {
+		c.log.Info("deleting orphaned persistent volume claim", zap.String("pvc", pvc.GetName()))
+		c.deletePVC(pvc.GetName())
+	}
+}
+
+func (c *check) deletePod(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	err := c.client.CoreV1().Pods(c.namespace).Delete(ctx, name, metav1.DeleteOptions{GracePeriodSeconds: new(int64)})
+	if err != nil && !kerrors.IsNotFound(err) {
+		c.log.Error("cannot delete pod", zap.String("pod", name), zap.Error(err))
+	}
+}
+
+func (c *check) deletePVC(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), cleanupTimeout)
+	defer cancel()
+	err := c.client.CoreV1().PersistentVolumeClaims(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !kerrors.IsNotFound(err) {
+		c.log.Error("cannot delete persistent volume claim", zap.String("pvc", name), zap.Error(err))
+	}
+}
+
+func (c *check) pvc(name string) *corev1.PersistentVolumeClaim {
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: c.meta(name),
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: c.size},
+			},
+		},
+	}
+	if c.storageClass != "" {
+		pvc.Spec.StorageClassName = &c.storageClass
+	}
+	return pvc
+}
+
+func (c *check) pod(name, claim string) *corev1.Pod {
+	f := mountPath + "/kubernary"
+	return &corev1.Pod{
+		ObjectMeta: c.meta(name),
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			TerminationGracePeriodSeconds: new(int64),
+			AutomountServiceAccountToken:  new(bool),
+			Containers: []corev1.Container{{
+				Name:            "readwrite",
+				Image:           c.image,
+				Command:         []string{"sh", "-c", fmt.Sprintf("echo %s > %s && grep -q %s %s", name, f, name, f)},
+				ImagePullPolicy: corev1.PullIfNotPresent,
+				VolumeMounts:    []corev1.VolumeMount{{Name: "data", MountPath: mountPath}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: "data",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim},
+				},
+			}},
+		},
+	}
+}
+
+func scheduled(p *corev1.Pod) bool {
+	for _, c := range p.Status.Conditions {
+		if c.Type == corev1.PodScheduled && c.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// started returns true if all of the pod's containers have started, and thus
+// that its volume has been attached and mounted.
+func started(p *corev1.Pod) bool {
+	if len(p.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, s := range p.Status.ContainerStatuses {
+		if s.State.Running == nil && s.State.Terminated == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *check) timing(stage string, d time.Duration) {
+	metric := stage + "." + metricLatency
+	if err := c.stats.TimingDuration(metric, d, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+// progress tracks when each stage of the check completed.
+type progress struct {
+	created time.Time
+	bound   time.Time
+	sched   time.Time
+	started time.Time
+	done    bool
+}
+
+// stage returns the first stage that has not completed.
+func (p *progress) stage(mount bool) string {
+	switch {
+	case p.bound.IsZero():
+		return StageBind
+	case mount && p.started.IsZero():
+		return StageAttach
+	}
+	return StageReadWrite
+}
+
+// observe updates the progress of the check using the current state of the
+// supplied PersistentVolumeClaim and (optional) pod.
+func (c *check) observe(p *progress, pvc *corev1.PersistentVolumeClaim, pod *corev1.Pod) error {
+	now := time.Now()
+	if p.bound.IsZero() && pvc.Status.Phase == corev1.ClaimBound {
+		p.bound = now
+		c.timing(StageBind, p.bound.Sub(p.created))
+	}
+	if pvc.Status.Phase == corev1.ClaimLost {
+		return errors.Errorf("persistent volume claim %s lost its volume", pvc.GetName())
+	}
+	if pod == nil {
+		p.done = !p.bound.IsZero()
+		return nil
+	}
+	if p.sched.IsZero() && scheduled(pod) {
+		p.sched = now
+	}
+	if p.started.IsZero() && !p.sched.IsZero() && started(pod) {
+		p.started = now
+		c.timing(StageAttach, p.started.Sub(p.sched))
+	}
+	switch pod.Status.Phase {
+	case corev1.PodFailed:
+		return errors.Errorf("pod %s could not write to and read from its volume", pod.GetName())
+	case corev1.PodSucceeded:
+		p.done = !p.bound.IsZero()
+	}
+	return nil
+}
+
+func (c *check) checkVolume(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	name := fmt.Sprintf("kubernary-%s-%s", c.name, rand.String(5))
+	pvcs := c.client.CoreV1().PersistentVolumeClaims(c.namespace)
+	pods := c.client.CoreV1().Pods(c.namespace)
+
+	p := &progress{created: time.Now()}
+	if _, err := pvcs.Create(ctx, c.pvc(name), metav1.CreateOptions{}); err != nil {
+		c.inc(metricFailed + "." + StageBind)
+		return errors.Wrapf(err, "cannot create persistent volume claim %s", name)
+	}
+	defer c.deletePVC(name)
+
+	if c.mount {
+		if _, err := pods.Create(ctx, c.pod(name, name), metav1.CreateOptions{}); err != nil {
+			c.inc(metricFailed + "." + StageAttach)
+			return errors.Wrapf(err, "cannot create pod %s", name)
+		}
+		// The pod must be deleted before its claim may be.
+		defer c.deletePod(name)
+	}
+
+	t := time.NewTicker(c.poll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			stage := p.stage(c.mount)
+			c.inc(metricFailed + "." + stage)
+			return errors.Errorf("persistent volume claim %s stuck in %s stage after %s", name, stage, time.Since(p.created))
+		case <-t.C:
+			pvc, err := pvcs.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				continue
+			}
+			var pod *corev1.Pod
+			if c.mount {
+				if pod, err = pods.Get(ctx, name, metav1.GetOptions{}); err != nil {
+					continue
+				}
+			}
+			if err := c.observe(p, pvc, pod); err != nil {
+				stage := p.stage(c.mount)
+				c.inc(metricFailed + "." + stage)
+				return errors.Wrapf(err, "%s stage failed", stage)
+			}
+			if p.done {
+				c.inc(metricSucceeded)
+				return nil
+			}
+		}
+	}
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext provisions a volume, giving up when the supplied context is
+// done. The volume and any pod mounting it are deleted regardless.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkVolume(ctx); err != nil {
+		c.log.Error("volume check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s volume check failed", c.name)
+	}
+	c.log.Debug("volume check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,242 @@
+package pvc
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testNamespace string = "kubernary"
+
+// provisioner pretends to be a volume provisioner, scheduler and kubelet. It
+// binds the first claim it sees, then progresses the first pod it sees through
+// the supplied statuses.
+func provisioner(t *testing.T, k kubernetes.Interface, bind bool, statuses ...corev1.PodStatus) {
+	ctx := context.Background()
+	var pvc *corev1.PersistentVolumeClaim
+	for pvc == nil {
+		l, err := k.CoreV1().PersistentVolumeClaims(testNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Errorf("List(): %v", err)
+			return
+		}
+		if len(l.Items) > 0 {
+			pvc = &l.Items[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if bind {
+		pvc.Status.Phase = corev1.ClaimBound
+		if _, err := k.CoreV1().PersistentVolumeClaims(testNamespace).UpdateStatus(ctx, pvc, metav1.UpdateOptions{}); err != nil {
+			t.Errorf("UpdateStatus(): %v", err)
+			return
+		}
+	}
+	if len(statuses) == 0 {
+		return
+	}
+	p, err := k.CoreV1().Pods(testNamespace).Get(ctx, pvc.GetName(), metav1.GetOptions{})
+	if err != nil {
+		t.Errorf("Get(): %v", err)
+		return
+	}
+	for _, s := range statuses {
+		time.Sleep(5 * time.Millisecond)
+		p.Status = s
+		if p, err = k.CoreV1().Pods(testNamespace).UpdateStatus(ctx, p, metav1.UpdateOptions{}); err != nil {
+			t.Errorf("UpdateStatus(): %v", err)
+			return
+		}
+	}
+}
+
+var (
+	pending = corev1.PodStatus{
+		Phase:      corev1.PodPending,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+	}
+	running = corev1.PodStatus{
+		Phase:      corev1.PodRunning,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "readwrite",
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		}},
+	}
+	succeeded = corev1.PodStatus{
+		Phase:      corev1.PodSucceeded,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "readwrite",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 0}},
+		}},
+	}
+	failed = corev1.PodStatus{
+		Phase:      corev1.PodFailed,
+		Conditions: []corev1.PodCondition{{Type: corev1.PodScheduled, Status: corev1.ConditionTrue}},
+		ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "readwrite",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 1}},
+		}},
+	}
+)
+
+var checkTests = []struct {
+	name      string
+	mount     bool
+	bind      bool
+	statuses  []corev1.PodStatus
+	wantStage string
+}{
+	{name: "bound", bind: true},
+	{name: "unbound", wantStage: StageBind},
+	{name: "mounted", mount: true, bind: true, statuses: []corev1.PodStatus{pending, running, succeeded}},
+	{name: "unattached", mount: true, bind: true, statuses: []corev1.PodStatus{pending}, wantStage: StageAttach},
+	{name: "unwritable", mount: true, bind: true, statuses: []corev1.PodStatus{pending, running, failed}, wantStage: StageReadWrite},
+}
+
+func TestPVCCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		k := fake.NewSimpleClientset()
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := []Option{Client(k), Logger(l), Namespace(testNamespace), Mount(tt.mount), Timeout(300 * time.Millisecond)}
+
+		c, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+		c.(*check).poll = 10 * time.Millisecond
+
+		go provisioner(t, k, tt.bind, tt.statuses...)
+		err = c.Check()
+
+		if tt.wantStage == "" && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+		if tt.wantStage != "" {
+			if err == nil {
+				t.Errorf("%s: got no error, wanted check to fail during %s", tt.name, tt.wantStage)
+			} else if !strings.Contains(err.Error(), tt.wantStage+" stage") {
+				t.Errorf("%s: want error naming stage %s, got %v", tt.name, tt.wantStage, err)
+			}
+		}
+
+		pvcs, _ := k.CoreV1().PersistentVolumeClaims(testNamespace).List(context.Background(), metav1.ListOptions{})
+		pods, _ := k.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+		if len(pvcs.Items)+len(pods.Items) > 0 {
+			t.Errorf("%s: want everything cleaned up, found %d claims and %d pods", tt.name, len(pvcs.Items), len(pods.Items))
+		}
+	}
+}
+
+func TestPVCCheckCleansUpOrphans(t *testing.T) {
+	orphan := func(instance string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "kubernary-orphans-" + instance,
+			Labels:    map[string]string{"app": "kubernary", "check": "orphans", "instance": instance},
+		}
+	}
+	mine, theirs := orphan("kubernary-a"), orphan("kubernary-b")
+	k := fake.NewSimpleClientset(
+		&corev1.PersistentVolumeClaim{ObjectMeta: mine}, &corev1.Pod{ObjectMeta: mine},
+		&corev1.PersistentVolumeClaim{ObjectMeta: theirs}, &corev1.Pod{ObjectMeta: theirs},
+	)
+
+	s, _ := statsd.NewNoopClient()
+	if _, err := New("orphans", s, Client(k), Namespace(testNamespace), Instance("kubernary-a")); err != nil {
+		t.Fatalf("New(orphans, Instance(kubernary-a)): %v", err)
+	}
+
+	pvcs, _ := k.CoreV1().PersistentVolumeClaims(testNamespace).List(context.Background(), metav1.ListOptions{})
+	pods, _ := k.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+	if len(pvcs.Items) != 1 || pvcs.Items[0].GetName() != theirs.Name {
+		t.Errorf("want only claim %s left, found %d claims", theirs.Name, len(pvcs.Items))
+	}
+	if len(pods.Items) != 1 || pods.Items[0].GetName() != theirs.Name {
+		t.Errorf("want only pod %s left, found %d pods", theirs.Name, len(pods.Items))
+	}
+
+	if _, err := New("orphans", s, Client(k), Namespace(testNamespace), Instance("kubernary-b")); err != nil {
+		t.Fatalf("New(orphans, Instance(kubernary-b)): %v", err)
+	}
+
+	pvcs, _ = k.CoreV1().PersistentVolumeClaims(testNamespace).List(context.Background(), metav1.ListOptions{})
+	pods, _ = k.CoreV1().Pods(testNamespace).List(context.Background(), metav1.ListOptions{})
+	if len(pvcs.Items)+len(pods.Items) > 0 {
+		t.Errorf("want orphans cleaned up, found %d claims and %d pods", len(pvcs.Items), len(pods.Items))
+	}
+}
+
+var ownerTests = []struct {
+	name      string
+	env       map[string]string
+	o         []Option
+	wantOwner string
+}{
+	{
+		name:      "FromEnv",
+		env:       map[string]string{"KUBERNARY_POD_NAME": "kubernary-abcde", "KUBERNARY_POD_NAMESPACE": testNamespace, "KUBERNARY_POD_UID": "1234"},
+		wantOwner: "kubernary-abcde",
+	},
+	{
+		name: "OtherNamespace",
+		env:  map[string]string{"KUBERNARY_POD_NAME": "kubernary-abcde", "KUBERNARY_POD_NAMESPACE": "default", "KUBERNARY_POD_UID": "1234"},
+	},
+	{
+		name: "UnknownUID",
+		env:  map[string]string{"KUBERNARY_POD_NAME": "kubernary-abcde", "KUBERNARY_POD_NAMESPACE": testNamespace},
+	},
+	{
+		name:      "Option",
+		o:         []Option{Owner("kubernary-fghij", "5678")},
+		wantOwner: "kubernary-fghij",
+	},
+}
+
+func TestPVCCheckOwner(t *testing.T) {
+	for _, tt := range ownerTests {
+		for k, v := range tt.env {
+			os.Setenv(k, v) // nolint: errcheck
+		}
+
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{Client(fake.NewSimpleClientset()), Namespace(testNamespace)}, tt.o...)
+		c, err := New(tt.name, s, o...)
+		for k := range tt.env {
+			os.Unsetenv(k) // nolint: errcheck
+		}
+		if err != nil {
+			t.Errorf("%s: New(): %v", tt.name, err)
+			continue
+		}
+
+		ck := c.(*check)
+		for _, m := range []metav1.ObjectMeta{ck.pvc("test").ObjectMeta, ck.pod("test", "test").ObjectMeta} {
+			got := ""
+			if len(m.OwnerReferences) > 0 {
+				got = m.OwnerReferences[0].Name
+			}
+			if got != tt.wantOwner {
+				t.Errorf("%s: owner: want %q, got %q", tt.name, tt.wantOwner, got)
+			}
+		}
+	}
+}
@@ -1,15 +1,24 @@
 package s3
 
 import (
+	"context"
+	"strconv"
+
 	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/dogstatsd"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager/s3manageriface"
 	"github.com/cactus/go-statsd-client/statsd"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -17,13 +26,25 @@ const (
 	metricDownloadSucceeded string = "download.succeeded"
 	metricDownloadFailed    string = "download.failed"
 
-	cfgRegion string = "REGION"
-	cfgBucket string = "BUCKET"
-	cfgKey    string = "KEY"
+	tagCategory string = "category"
+
+	cfgRegion     string = "REGION"
+	cfgBucket     string = "BUCKET"
+	cfgKey        string = "KEY"
+	cfgEndpoint   string = "ENDPOINT"
+	cfgPathStyle  string = "PATH_STYLE"
+	cfgDisableSSL string = "DISABLE_SSL"
+	cfgRoleARN    string = "ROLE_ARN"
+	cfgSampleRate string = "SAMPLE_RATE"
 
-	defaultRegion string = "us-east-1"
-	defaultBucket string = "kubernary"
-	defaultKey    string = "check"
+	defaultRegion     string = "us-east-1"
+	defaultBucket     string = "kubernary"
+	defaultKey        string = "check"
+	defaultEndpoint   string = ""
+	defaultPathStyle  string = "false"
+	defaultDisableSSL string = "false"
+	defaultRoleARN    string = ""
+	defaultSampleRate string = "1.0"
 )
 
 type check struct {
@@ -33,14 +54,32 @@ type check struct {
 	downloader s3manageriface.DownloaderAPI
 	bucket     string
 	key        string
+	region     string
+	endpoint   string
+	pathStyle  bool
+	disableSSL bool
+	roleARN    string
+	sampleRate float32
 }
 
-func newDownloader(region string) (s3manageriface.DownloaderAPI, error) {
-	// TODO(negz): Make region configurable.
-	s, err := session.NewSession(aws.NewConfig().WithRegion(region))
+func newDownloader(c *check) (s3manageriface.DownloaderAPI, error) {
+	cfg := aws.NewConfig().
+		WithRegion(c.region).
+		WithS3ForcePathStyle(c.pathStyle).
+		WithDisableSSL(c.disableSSL)
+	if c.endpoint != "" {
+		cfg = cfg.WithEndpoint(c.endpoint)
+	}
+	s, err := session.NewSession(cfg)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot create new AWS session")
 	}
+	traceRequests(&s.Handlers)
+	if c.roleARN != "" {
+		// Credentials for the assumed role are sourced from the base session,
+		// e.g. the pod's kube2iam role or the node's instance profile.
+		s = s.Copy(aws.NewConfig().WithCredentials(stscreds.NewCredentials(s, c.roleARN)))
+	}
 	return s3manager.NewDownloader(s), nil
 }
 
@@ -63,6 +102,62 @@ func Logger(l *zap.Logger) Option {
 	}
 }
 
+// Region sets the AWS region in which the bucket lives.
+func Region(r string) Option {
+	return func(c *check) error {
+		c.region = r
+		return nil
+	}
+}
+
+// Endpoint allows the use of a bespoke S3 compatible endpoint URL, for example
+// a MinIO or Ceph deployment, or a local fake S3.
+func Endpoint(url string) Option {
+	return func(c *check) error {
+		c.endpoint = url
+		return nil
+	}
+}
+
+// PathStyle determines whether buckets are addressed via the URL path (i.e.
+// http://endpoint/bucket/key) rather than a virtual hosted subdomain. Most
+// non-AWS S3 implementations require path style addressing.
+func PathStyle(p bool) Option {
+	return func(c *check) error {
+		c.pathStyle = p
+		return nil
+	}
+}
+
+// DisableSSL determines whether the S3 endpoint is spoken to over plain HTTP.
+func DisableSSL(d bool) Option {
+	return func(c *check) error {
+		c.disableSSL = d
+		return nil
+	}
+}
+
+// AssumeRole causes the check to assume the supplied IAM role ARN before
+// downloading from S3.
+func AssumeRole(arn string) Option {
+	return func(c *check) error {
+		c.roleARN = arn
+		return nil
+	}
+}
+
+// SampleRate sets the rate at which the check's metrics are sampled, between 0
+// and 1.
+func SampleRate(r float32) Option {
+	return func(c *check) error {
+		if r <= 0 || r > 1 {
+			return errors.Errorf("sample rate must be greater than 0 and at most 1, got %v", r)
+		}
+		c.sampleRate = r
+		return nil
+	}
+}
+
 // New returns a Checker that checks whether the supplied S3 file is accessible.
 func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
 	l, err := zap.NewProduction()
@@ -71,20 +166,44 @@ func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error)
 	}
 
 	cfg := map[string]string{
-		cfgRegion: defaultRegion,
-		cfgBucket: defaultBucket,
-		cfgKey:    defaultKey,
+		cfgRegion:     defaultRegion,
+		cfgBucket:     defaultBucket,
+		cfgKey:        defaultKey,
+		cfgEndpoint:   defaultEndpoint,
+		cfgPathStyle:  defaultPathStyle,
+		cfgDisableSSL: defaultDisableSSL,
+		cfgRoleARN:    defaultRoleARN,
+		cfgSampleRate: defaultSampleRate,
 	}
 	cfg = kubernary.CheckConfigFromEnv(name, cfg)
 
+	pathStyle, err := strconv.ParseBool(cfg[cfgPathStyle])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgPathStyle)
+	}
+	disableSSL, err := strconv.ParseBool(cfg[cfgDisableSSL])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgDisableSSL)
+	}
+	sampleRate, err := strconv.ParseFloat(cfg[cfgSampleRate], 32)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgSampleRate)
+	}
+
 	c := &check{
-		name:   name,
-		stats:  s.NewSubStatter(name),
-		log:    l,
-		bucket: cfg[cfgBucket],
-		key:    cfg[cfgKey],
+		name:       name,
+		stats:      s.NewSubStatter(name),
+		log:        l,
+		bucket:     cfg[cfgBucket],
+		key:        cfg[cfgKey],
+		region:     cfg[cfgRegion],
+		endpoint:   cfg[cfgEndpoint],
+		pathStyle:  pathStyle,
+		disableSSL: disableSSL,
+		roleARN:    cfg[cfgRoleARN],
 	}
 
+	co = append([]Option{SampleRate(float32(sampleRate))}, co...)
 	for _, o := range co {
 		if err := o(c); err != nil {
 			return nil, errors.Wrap(err, "cannot apply S3 Checker option")
@@ -95,7 +214,7 @@ func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error)
 
 	if c.downloader == nil {
 		var err error
-		c.downloader, err = newDownloader(cfg[cfgRegion])
+		c.downloader, err = newDownloader(c)
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot create S3 downloader")
 		}
@@ -104,19 +223,90 @@ func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error)
 	return c, nil
 }
 
-func (c *check) checkCanDownload() error {
-	_, err := c.downloader.Download(&aws.WriteAtBuffer{}, &s3.GetObjectInput{
+// categories maps AWS error codes to check failure categories.
+var categories = map[string]kubernary.Category{
+	"AccessDenied":          kubernary.CategoryAuth,
+	"AccountProblem":        kubernary.CategoryAuth,
+	"AllAccessDisabled":     kubernary.CategoryAuth,
+	"ExpiredToken":          kubernary.CategoryAuth,
+	"InvalidAccessKeyId":    kubernary.CategoryAuth,
+	"InvalidToken":          kubernary.CategoryAuth,
+	"NoCredentialProviders": kubernary.CategoryAuth,
+	"SignatureDoesNotMatch": kubernary.CategoryAuth,
+	"NoSuchBucket":          kubernary.CategoryNotFound,
+	"NoSuchKey":             kubernary.CategoryNotFound,
+	"NotFound":              kubernary.CategoryNotFound,
+	"RequestCanceled":       kubernary.CategoryTimeout,
+	"RequestTimeout":        kubernary.CategoryTimeout,
+	"RequestError":          kubernary.CategoryNetwork,
+	"InternalError":         kubernary.CategoryNetwork,
+	"ServiceUnavailable":    kubernary.CategoryNetwork,
+	"SlowDown":              kubernary.CategoryNetwork,
+}
+
+// retryable AWS error categories. Auth and not found errors require
+// intervention.
+var retryable = map[kubernary.Category]bool{
+	kubernary.CategoryTimeout: true,
+	kubernary.CategoryNetwork: true,
+}
+
+// categorize classifies the supplied AWS error by its code or, failing that,
+// its HTTP status code.
+func categorize(err error) *kubernary.CheckError {
+	ce := kubernary.NewCheckError(kubernary.CategoryUnknown, false, err)
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return ce
+	}
+	ce.WithField("code", aerr.Code())
+	if c, ok := categories[aerr.Code()]; ok {
+		ce.Category = c
+	}
+	if rerr, ok := err.(awserr.RequestFailure); ok && ce.Category == kubernary.CategoryUnknown {
+		switch code := rerr.StatusCode(); {
+		case code == 401 || code == 403:
+			ce.Category = kubernary.CategoryAuth
+		case code == 404:
+			ce.Category = kubernary.CategoryNotFound
+		case code >= 500:
+			ce.Category = kubernary.CategoryNetwork
+		}
+	}
+	ce.Retryable = retryable[ce.Category]
+	return ce
+}
+
+func (c *check) checkCanDownload(ctx context.Context) error {
+	ctx, span := kubernary.Tracer().Start(ctx, spanDownload, trace.WithAttributes(
+		attribute.String("aws.s3.bucket", c.bucket),
+		attribute.String("aws.s3.key", c.key),
+	))
+	defer span.End()
+
+	_, err := c.downloader.DownloadWithContext(ctx, &aws.WriteAtBuffer{}, &s3.GetObjectInput{
 		Bucket: aws.String(c.bucket),
 		Key:    aws.String(c.key),
 	})
 	if err != nil {
-		if serr := c.stats.Inc(metricDownloadFailed, 1, 1.0); serr != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		ce := categorize(err).WithField("bucket", c.bucket).WithField("key", c.key)
+		if _, ok := c.stats.(dogstatsd.Tagger); !ok {
+			// Without tags we count all failures, as well as failures by
+			// category, so that total failures need not be summed.
+			if serr := c.stats.Inc(metricDownloadFailed, 1, c.sampleRate); serr != nil {
+				c.log.Error("cannot emit metric", zap.String("metric", metricDownloadFailed), zap.Error(serr))
+			}
+		}
+		tag := dogstatsd.Tag{Key: tagCategory, Value: string(ce.Category)}
+		if serr := dogstatsd.Inc(c.stats, metricDownloadFailed, 1, c.sampleRate, tag); serr != nil {
 			c.log.Error("cannot emit metric", zap.String("metric", metricDownloadFailed), zap.Error(serr))
 		}
-		c.log.Error("download check failed", zap.Error(err))
-		return errors.Wrapf(err, "%s download check failed, bucket=%s, key=%s", c.name, c.bucket, c.key)
+		c.log.Error("download check failed", zap.Error(err), zap.String("category", string(ce.Category)))
+		return errors.Wrapf(ce, "%s download check failed, bucket=%s, key=%s", c.name, c.bucket, c.key)
 	}
-	if err := c.stats.Inc(metricDownloadSucceeded, 1, 1.0); err != nil {
+	if err := c.stats.Inc(metricDownloadSucceeded, 1, c.sampleRate); err != nil {
 		c.log.Error("cannot emit metric", zap.String("metric", metricDownloadSucceeded), zap.Error(err))
 	}
 	c.log.Debug("download check succeeded")
@@ -124,7 +314,15 @@ func (c *check) checkCanDownload() error {
 }
 
 func (c *check) Check() error {
-	return errors.Wrapf(c.checkCanDownload(), "%s download check failed", c.name)
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext checks whether the configured S3 file is accessible,
+// abandoning the download if the supplied context is done first. The download
+// and the AWS API requests it makes are traced as children of any span in the
+// supplied context.
+func (c *check) CheckContext(ctx context.Context) error {
+	return errors.Wrapf(c.checkCanDownload(ctx), "%s download check failed", c.name)
 }
 
 func (c *check) Name() string {
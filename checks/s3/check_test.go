@@ -1,14 +1,20 @@
 package s3
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"os"
 	"testing"
 
 	"go.uber.org/zap"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/negz/kubernary"
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +23,10 @@ type predictableDownloader struct {
 }
 
 func (d *predictableDownloader) Download(w io.WriterAt, i *s3.GetObjectInput, o ...func(*s3manager.Downloader)) (int64, error) {
+	return d.DownloadWithContext(context.Background(), w, i, o...)
+}
+
+func (d *predictableDownloader) DownloadWithContext(ctx aws.Context, w io.WriterAt, i *s3.GetObjectInput, o ...func(*s3manager.Downloader)) (int64, error) {
 	if d.err != nil {
 		return 0, d.err
 	}
@@ -59,3 +69,61 @@ func TestS3Check(t *testing.T) {
 		}
 	}
 }
+
+func TestS3CheckBadConfig(t *testing.T) {
+	for _, k := range []string{cfgPathStyle, cfgDisableSSL, cfgSampleRate} {
+		name := "badconfig"
+		env := fmt.Sprintf("%s%s_%s", kubernary.CheckConfigEnvPrefix, "BADCONFIG", k)
+		os.Setenv(env, "notabool")
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		if _, err := New(name, s, Downloader(&predictableDownloader{})); err == nil {
+			t.Errorf("New(%v, %v, Downloader()) with %s=notabool: want error, got nil", name, s, env)
+		}
+		os.Unsetenv(env)
+	}
+
+	s, _ := statsd.NewNoopClient()
+	for _, r := range []float32{0, 1.5} {
+		if _, err := New("badrate", s, Downloader(&predictableDownloader{}), SampleRate(r)); err == nil {
+			t.Errorf("New(SampleRate(%v)): want error, got nil", r)
+		}
+	}
+}
+
+var categorizeTests = []struct {
+	name      string
+	err       error
+	want      kubernary.Category
+	retryable bool
+}{
+	{"opaque", errors.New("boom!"), kubernary.CategoryUnknown, false},
+	{"accessdenied", awserr.New("AccessDenied", "Access Denied", nil), kubernary.CategoryAuth, false},
+	{"nosuchkey", awserr.New("NoSuchKey", "The specified key does not exist.", nil), kubernary.CategoryNotFound, false},
+	{"requesterror", awserr.New("RequestError", "send request failed", nil), kubernary.CategoryNetwork, true},
+	{"canceled", awserr.New("RequestCanceled", "request context canceled", nil), kubernary.CategoryTimeout, true},
+	{"forbidden", awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "id"), kubernary.CategoryAuth, false},
+	{"unavailable", awserr.NewRequestFailure(awserr.New("BadGateway", "Bad Gateway", nil), 502, "id"), kubernary.CategoryNetwork, true},
+}
+
+func TestCategorize(t *testing.T) {
+	for _, tt := range categorizeTests {
+		ce := categorize(tt.err)
+		if ce.Category != tt.want {
+			t.Errorf("%s: categorize(%v).Category: want %v, got %v", tt.name, tt.err, tt.want, ce.Category)
+		}
+		if ce.Retryable != tt.retryable {
+			t.Errorf("%s: categorize(%v).Retryable: want %v, got %v", tt.name, tt.err, tt.retryable, ce.Retryable)
+		}
+	}
+
+	s, _ := statsd.NewNoopClient()
+	check, err := New("categorized", s, Downloader(&predictableDownloader{err: awserr.New("NoSuchBucket", "nope", nil)}))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	if got := kubernary.CategoryOf(check.Check()); got != kubernary.CategoryNotFound {
+		t.Errorf("kubernary.CategoryOf(check.Check()): want %v, got %v", kubernary.CategoryNotFound, got)
+	}
+}
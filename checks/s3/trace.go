@@ -0,0 +1,95 @@
+package s3
+
+import (
+	"context"
+
+	"github.com/negz/kubernary"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	spanDownload string = "s3.download"
+	spanAttempt  string = "aws.attempt"
+)
+
+type spansKey struct{}
+
+// spans tracks the spans of one AWS API request.
+type spans struct {
+	request trace.Span
+	attempt trace.Span
+}
+
+func spansOf(r *request.Request) (*spans, bool) {
+	s, ok := r.Context().Value(spansKey{}).(*spans)
+	return s, ok
+}
+
+// traceRequests instruments the supplied AWS SDK handlers such that each API
+// request is traced as a span, with a child span for each attempt to send it.
+// Request spans are children of any span in the request's context.
+func traceRequests(h *request.Handlers) {
+	h.Validate.PushFrontNamed(request.NamedHandler{Name: "kubernary.StartRequestSpan", Fn: startRequestSpan})
+	h.Sign.PushFrontNamed(request.NamedHandler{Name: "kubernary.StartAttemptSpan", Fn: startAttemptSpan})
+	h.CompleteAttempt.PushBackNamed(request.NamedHandler{Name: "kubernary.EndAttemptSpan", Fn: endAttemptSpan})
+	h.Complete.PushBackNamed(request.NamedHandler{Name: "kubernary.EndRequestSpan", Fn: endRequestSpan})
+}
+
+func startRequestSpan(r *request.Request) {
+	ctx, span := kubernary.Tracer().Start(r.Context(), r.ClientInfo.ServiceName+"."+r.Operation.Name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "aws-api"),
+			attribute.String("rpc.service", r.ClientInfo.ServiceName),
+			attribute.String("rpc.method", r.Operation.Name),
+		))
+	r.SetContext(context.WithValue(ctx, spansKey{}, &spans{request: span}))
+}
+
+func startAttemptSpan(r *request.Request) {
+	s, ok := spansOf(r)
+	if !ok {
+		return
+	}
+	_, s.attempt = kubernary.Tracer().Start(r.Context(), spanAttempt,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("aws.retry_count", r.RetryCount)))
+}
+
+func endAttemptSpan(r *request.Request) {
+	s, ok := spansOf(r)
+	if !ok || s.attempt == nil {
+		return
+	}
+	endSpan(s.attempt, r)
+	s.attempt = nil
+}
+
+func endRequestSpan(r *request.Request) {
+	s, ok := spansOf(r)
+	if !ok {
+		return
+	}
+	// Requests that fail to sign never complete their attempt.
+	endAttemptSpan(r)
+	s.request.SetAttributes(attribute.Int("aws.retry_count", r.RetryCount))
+	if r.RequestID != "" {
+		s.request.SetAttributes(attribute.String("aws.request_id", r.RequestID))
+	}
+	endSpan(s.request, r)
+}
+
+func endSpan(span trace.Span, r *request.Request) {
+	defer span.End()
+	if r.HTTPResponse != nil && r.HTTPResponse.StatusCode > 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", r.HTTPResponse.StatusCode))
+	}
+	if r.Error != nil {
+		span.RecordError(r.Error)
+		span.SetStatus(codes.Error, r.Error.Error())
+	}
+}
@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/negz/kubernary"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/cactus/go-statsd-client/statsd"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return exp
+}
+
+func TestTraceDownload(t *testing.T) {
+	exp := recordSpans(t)
+	s, _ := statsd.NewNoopClient()
+	check, err := New("traced", s, Downloader(&predictableDownloader{err: awserr.New("NoSuchKey", "nope", nil)}))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+
+	ctx, parent := kubernary.Tracer().Start(context.Background(), "parent")
+	if err := check.(kubernary.ContextChecker).CheckContext(ctx); err == nil {
+		t.Error("check.CheckContext(): want error, got nil")
+	}
+	parent.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exp.GetSpans(): want 2 spans, got %d", len(spans))
+	}
+	download := spans[0]
+	if download.Name != spanDownload {
+		t.Errorf("download.Name: want %s, got %s", spanDownload, download.Name)
+	}
+	if download.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("download.Parent.SpanID(): want %s, got %s", parent.SpanContext().SpanID(), download.Parent.SpanID())
+	}
+	if download.Status.Code != codes.Error {
+		t.Errorf("download.Status.Code: want %v, got %v", codes.Error, download.Status.Code)
+	}
+}
+
+func TestTraceRequests(t *testing.T) {
+	exp := recordSpans(t)
+	h := request.Handlers{}
+	traceRequests(&h)
+	h.Send.PushBack(func(r *request.Request) {
+		r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(""))}
+	})
+
+	ctx, parent := kubernary.Tracer().Start(context.Background(), "parent")
+	r := request.New(aws.Config{},
+		metadata.ClientInfo{ServiceName: "s3", Endpoint: "https://example.org"},
+		h, nil, &request.Operation{Name: "GetObject", HTTPMethod: "GET", HTTPPath: "/"}, nil, nil)
+	r.SetContext(ctx)
+	if err := r.Send(); err != nil {
+		t.Fatalf("r.Send(): %v", err)
+	}
+	parent.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("exp.GetSpans(): want 3 spans, got %d", len(spans))
+	}
+	attempt, req := spans[0], spans[1]
+	if req.Name != "s3.GetObject" {
+		t.Errorf("req.Name: want s3.GetObject, got %s", req.Name)
+	}
+	if req.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("req.Parent.SpanID(): want %s, got %s", parent.SpanContext().SpanID(), req.Parent.SpanID())
+	}
+	if attempt.Name != spanAttempt {
+		t.Errorf("attempt.Name: want %s, got %s", spanAttempt, attempt.Name)
+	}
+	if attempt.Parent.SpanID() != req.SpanContext.SpanID() {
+		t.Errorf("attempt.Parent.SpanID(): want %s, got %s", req.SpanContext.SpanID(), attempt.Parent.SpanID())
+	}
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/kube"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	metricSucceeded string = "succeeded"
+	metricFailed    string = "failed"
+	metricLatency   string = "latency"
+
+	cfgNamespace     string = "NAMESPACE"
+	cfgService       string = "SERVICE"
+	cfgPort          string = "PORT"
+	cfgClusterDomain string = "CLUSTER_DOMAIN"
+	cfgTimeout       string = "TIMEOUT"
+
+	defaultNamespace     string = "default"
+	defaultService       string = ""
+	defaultPort          string = ""
+	defaultClusterDomain string = "cluster.local"
+	defaultTimeout       string = "2s"
+)
+
+// Paths via which the check tries to reach the Service's backends. Each is
+// emitted as a distinct metric.
+const (
+	PathClusterIP string = "clusterip"
+	PathDNS       string = "dns"
+	PathEndpoints string = "endpoints"
+)
+
+// A Dialer dials network connections. *net.Dialer satisfies this interface.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+type check struct {
+	name      string
+	stats     statsd.SubStatter
+	log       *zap.Logger
+	client    kubernetes.Interface
+	dialer    Dialer
+	namespace string
+	service   string
+	port      string
+	domain    string
+	timeout   time.Duration
+}
+
+// An Option represents a Service checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke Kubernetes client.
+func Client(k kubernetes.Interface) Option {
+	return func(c *check) error {
+		c.client = k
+		return nil
+	}
+}
+
+// WithDialer allows the use of a bespoke network dialer.
+func WithDialer(d Dialer) Option {
+	return func(c *check) error {
+		c.dialer = d
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Service sets the namespace and name of the Service to reach.
+func Service(namespace, name string) Option {
+	return func(c *check) error {
+		c.namespace = namespace
+		c.service = name
+		return nil
+	}
+}
+
+// Port sets the name or number of the Service port to reach. The Service's
+// first port is reached by default.
+func Port(p string) Option {
+	return func(c *check) error {
+		c.port = p
+		return nil
+	}
+}
+
+// ClusterDomain sets the cluster's DNS domain.
+func ClusterDomain(d string) Option {
+	return func(c *check) error {
+		c.domain = d
+		return nil
+	}
+}
+
+// Timeout sets the longest connecting via any one path may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether a Service's backends can be
+// reached via its ClusterIP, its DNS name, and directly.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgNamespace:     defaultNamespace,
+		cfgService:       defaultService,
+		cfgPort:          defaultPort,
+		cfgClusterDomain: defaultClusterDomain,
+		cfgTimeout:       defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:      name,
+		stats:     s.NewSubStatter(name),
+		log:       l,
+		dialer:    &net.Dialer{},
+		namespace: cfg[cfgNamespace],
+		service:   cfg[cfgService],
+		port:      cfg[cfgPort],
+		domain:    cfg[cfgClusterDomain],
+		timeout:   timeout,
+	}
+
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply Service Checker option")
+		}
+	}
+
+	if c.service == "" {
+		return nil, errors.New("Service Checker requires a Service")
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.String("namespace", c.namespace), zap.String("service", c.service))
+
+	if c.client == nil {
+		var err error
+		c.client, err = kube.InClusterClient()
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create Kubernetes client")
+		}
+	}
+
+	return c, nil
+}
+
+func (c *check) servicePort(svc *corev1.Service) (*corev1.ServicePort, error) {
+	for i := range svc.Spec.Ports {
+		p := &svc.Spec.Ports[i]
+		if c.port == "" || c.port == p.Name || c.port == strconv.Itoa(int(p.Port)) {
+			return p, nil
+		}
+	}
+	return nil, errors.Errorf("Service %s/%s has no port %q", c.namespace, c.service, c.port)
+}
+
+// endpoints returns the addresses of the Service's ready endpoints.
+func (c *check) endpoints(ctx context.Context, sp *corev1.ServicePort) ([]string, error) {
+	sel := discoveryv1.LabelServiceName + "=" + c.service
+	slices, err := c.client.DiscoveryV1().EndpointSlices(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: sel})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list EndpointSlices")
+	}
+	addrs := []string{}
+	for _, s := range slices.Items {
+		port := int32(0)
+		for _, p := range s.Ports {
+			name := ""
+			if p.Name != nil {
+				name = *p.Name
+			}
+			if p.Port != nil && name == sp.Name {
+				port = *p.Port
+			}
+		}
+		if port == 0 {
+			continue
+		}
+		for _, e := range s.Endpoints {
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready {
+				continue
+			}
+			for _, a := range e.Addresses {
+				addrs = append(addrs, net.JoinHostPort(a, strconv.Itoa(int(port))))
+			}
+		}
+	}
+	return addrs, nil
+}
+
+func (c *check) emit(path string, took time.Duration, err error) {
+	metric := path + "." + metricLatency
+	if serr := c.stats.TimingDuration(metric, took, 1.0); serr != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(serr))
+	}
+	metric = path + "." + metricSucceeded
+	if err != nil {
+		metric = path + "." + metricFailed
+	}
+	if serr := c.stats.Inc(metric, 1, 1.0); serr != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(serr))
+	}
+}
+
+// reach connects to each of the supplied addresses via the supplied path.
+func (c *check) reach(ctx context.Context, path string, addrs ...string) error {
+	failures := []string{}
+	for _, addr := range addrs {
+		ctx, cancel := context.WithTimeout(ctx, c.timeout)
+		started := time.Now()
+		conn, err := c.dialer.DialContext(ctx, "tcp", addr)
+		cancel()
+		c.emit(path, time.Since(started), err)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		conn.Close()
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("%d of %d addresses unreachable: %s", len(failures), len(addrs), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func headless(svc *corev1.Service) bool {
+	return svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone
+}
+
+func (c *check) checkPaths(parent context.Context) error {
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	svc, err := c.client.CoreV1().Services(c.namespace).Get(ctx, c.service, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot get Service %s/%s", c.namespace, c.service)
+	}
+	sp, err := c.servicePort(svc)
+	if err != nil {
+		return err
+	}
+	port := strconv.Itoa(int(sp.Port))
+	eps, err := c.endpoints(ctx, sp)
+	if err != nil {
+		return err
+	}
+
+	errs := map[string]error{
+		PathDNS:       c.reach(parent, PathDNS, net.JoinHostPort(strings.Join([]string{c.service, c.namespace, "svc", c.domain}, "."), port)),
+		PathEndpoints: c.reach(parent, PathEndpoints, eps...),
+	}
+	// A headless Service has no ClusterIP, so kube-proxy plays no part in
+	// reaching it. Its DNS name resolves directly to its backends.
+	if headless(svc) {
+		c.log.Debug("skipping clusterip path of headless Service")
+	} else {
+		errs[PathClusterIP] = c.reach(parent, PathClusterIP, net.JoinHostPort(svc.Spec.ClusterIP, port))
+	}
+	if len(eps) == 0 {
+		errs[PathEndpoints] = errors.New("no ready endpoints")
+	}
+
+	// Work out which component is most likely broken. Traffic flows from DNS,
+	// to kube-proxy's ClusterIP, to the backend pods.
+	switch {
+	case errs[PathEndpoints] != nil:
+		return errors.Wrap(errs[PathEndpoints], "endpoints path failed; the Service's backends are unreachable")
+	case errs[PathClusterIP] != nil:
+		return errors.Wrap(errs[PathClusterIP], "clusterip path failed but backends are reachable directly; kube-proxy may be broken")
+	case errs[PathDNS] != nil:
+		return errors.Wrap(errs[PathDNS], "dns path failed but the ClusterIP is reachable; DNS may be broken")
+	}
+	return nil
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext checks each path to the Service, abandoning any connection or
+// API call in flight when the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkPaths(ctx); err != nil {
+		c.log.Error("reachability check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s reachability check failed", c.name)
+	}
+	c.log.Debug("reachability check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
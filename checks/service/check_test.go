@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// predictableDialer fails to dial any address containing one of its broken
+// substrings.
+type predictableDialer struct {
+	broken []string
+}
+
+func (d *predictableDialer) DialContext(_ context.Context, _, addr string) (net.Conn, error) {
+	for _, b := range d.broken {
+		if strings.Contains(addr, b) {
+			return nil, errors.Errorf("cannot dial %s", addr)
+		}
+	}
+	client, server := net.Pipe()
+	server.Close()
+	return client, nil
+}
+
+func objects(ready bool, clusterIP string) (*corev1.Service, *discoveryv1.EndpointSlice) {
+	name, port := "http", int32(8080)
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backend"},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: clusterIP,
+			Ports:     []corev1.ServicePort{{Name: name, Port: 80}},
+		},
+	}
+	eps := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "backend-abcde",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "backend"},
+		},
+		Ports: []discoveryv1.EndpointPort{{Name: &name, Port: &port}},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"192.168.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}},
+		},
+	}
+	return svc, eps
+}
+
+var checkTests = []struct {
+	name     string
+	broken   []string
+	notReady bool
+	headless bool
+	wantPath string
+}{
+	{name: "ok"},
+	{name: "kubeproxy", broken: []string{"10.0.0.10"}, wantPath: PathClusterIP},
+	{name: "dns", broken: []string{"backend.default.svc"}, wantPath: PathDNS},
+	{name: "backend", broken: []string{"192.168.0.1", "10.0.0.10", "backend.default.svc"}, wantPath: PathEndpoints},
+	{name: "notready", notReady: true, wantPath: PathEndpoints},
+	{name: "headless", headless: true, broken: []string{"None"}},
+	{name: "headlessdns", headless: true, broken: []string{"backend.default.svc"}, wantPath: PathDNS},
+}
+
+func TestServiceCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		clusterIP := "10.0.0.10"
+		if tt.headless {
+			clusterIP = corev1.ClusterIPNone
+		}
+		svc, eps := objects(!tt.notReady, clusterIP)
+		k := fake.NewSimpleClientset(svc, eps)
+		d := &predictableDialer{broken: tt.broken}
+
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := []Option{Client(k), WithDialer(d), Logger(l), Service("default", "backend"), Timeout(time.Second)}
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantPath == "" {
+			if err != nil {
+				t.Errorf("%s: got %v, did not want error.", tt.name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: got no error, wanted %s path to fail", tt.name, tt.wantPath)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.wantPath+" path failed") {
+			t.Errorf("%s: want error naming %s path, got %v", tt.name, tt.wantPath, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package sts
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/negz/kubernary"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	metricIdentityMatched    string = "identity.matched"
+	metricIdentityMismatched string = "identity.mismatched"
+	metricIdentityFallback   string = "identity.fallback"
+	metricIdentityFailed     string = "identity.failed"
+
+	cfgRegion      string = "REGION"
+	cfgRolePattern string = "ROLE_PATTERN"
+
+	defaultRegion      string = "us-east-1"
+	defaultRolePattern string = ":assumed-role/kubernary/"
+)
+
+// Credentials vended by the EC2 instance metadata service (i.e. the node's
+// instance role rather than a kube2iam or IRSA role) use the instance ID as
+// their role session name.
+var instanceRoleSession = regexp.MustCompile(`:assumed-role/[^/]+/i-[0-9a-f]+$`)
+
+type check struct {
+	name    string
+	stats   statsd.SubStatter
+	log     *zap.Logger
+	client  stsiface.STSAPI
+	pattern *regexp.Regexp
+}
+
+func newClient(region string) (stsiface.STSAPI, error) {
+	s, err := session.NewSession(aws.NewConfig().WithRegion(region))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create new AWS session")
+	}
+	return sts.New(s), nil
+}
+
+// An Option represents an STS checker option.
+type Option func(*check) error
+
+// Client allows the use of a bespoke STS client.
+func Client(s stsiface.STSAPI) Option {
+	return func(c *check) error {
+		c.client = s
+		return nil
+	}
+}
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// RolePattern sets the regular expression the caller identity ARN must match.
+func RolePattern(p string) Option {
+	return func(c *check) error {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return errors.Wrapf(err, "cannot compile role pattern %s", p)
+		}
+		c.pattern = r
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether the caller identity returned by
+// STS matches the supplied role pattern.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgRegion:      defaultRegion,
+		cfgRolePattern: defaultRolePattern,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	c := &check{
+		name:  name,
+		stats: s.NewSubStatter(name),
+		log:   l,
+	}
+
+	co = append([]Option{RolePattern(cfg[cfgRolePattern])}, co...)
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply STS Checker option")
+		}
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.Stringer("rolePattern", c.pattern))
+
+	if c.client == nil {
+		var err error
+		c.client, err = newClient(cfg[cfgRegion])
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create STS client")
+		}
+	}
+
+	return c, nil
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) checkIdentity(ctx context.Context) error {
+	id, err := c.client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		c.inc(metricIdentityFailed)
+		c.log.Error("caller identity check failed", zap.Error(err))
+		return errors.Wrapf(err, "%s cannot get caller identity", c.name)
+	}
+	arn := aws.StringValue(id.Arn)
+	// A permissive role pattern may also match the instance role, so reject
+	// it before checking the pattern.
+	if instanceRoleSession.MatchString(arn) {
+		c.inc(metricIdentityFallback)
+		c.log.Error("caller identity is the node's instance role", zap.String("arn", arn))
+		return errors.Errorf("%s caller identity %s is the node's instance role, not %s", c.name, arn, c.pattern)
+	}
+	if c.pattern.MatchString(arn) {
+		c.inc(metricIdentityMatched)
+		c.log.Debug("caller identity check succeeded", zap.String("arn", arn))
+		return nil
+	}
+	c.inc(metricIdentityMismatched)
+	c.log.Error("caller identity does not match role pattern", zap.String("arn", arn))
+	return errors.Errorf("%s caller identity %s does not match %s", c.name, arn, c.pattern)
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext checks the caller identity, abandoning the request if the
+// supplied context is done first.
+func (c *check) CheckContext(ctx context.Context) error {
+	return errors.Wrapf(c.checkIdentity(ctx), "%s caller identity check failed", c.name)
+}
+
+func (c *check) Name() string {
+	return c.name
+}
@@ -0,0 +1,84 @@
+package sts
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+)
+
+type predictableClient struct {
+	stsiface.STSAPI
+	arn string
+	err error
+}
+
+func (c *predictableClient) GetCallerIdentityWithContext(aws.Context, *sts.GetCallerIdentityInput, ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &sts.GetCallerIdentityOutput{Arn: aws.String(c.arn)}, nil
+}
+
+var checkTests = []struct {
+	name    string
+	arn     string
+	err     error
+	wantErr bool
+}{
+	{"matched", "arn:aws:sts::123456789012:assumed-role/kubernary/1490000000000000000", nil, false},
+	{"mismatched", "arn:aws:sts::123456789012:assumed-role/someoneelse/1490000000000000000", nil, true},
+	{"fallback", "arn:aws:sts::123456789012:assumed-role/nodes/i-0123456789abcdef0", nil, true},
+	{"kaboom", "", errors.New("boom!"), true},
+}
+
+func TestSTSCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+	for _, tt := range checkTests {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		cl := &predictableClient{arn: tt.arn, err: tt.err}
+
+		check, err := New(tt.name, s, Client(cl), Logger(l))
+		if err != nil {
+			t.Errorf("New(%v, %v, Client(%v), Logger(%v)): %v", tt.name, s, cl, l, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail for ARN %q", tt.name, tt.arn)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+	}
+}
+
+func TestSTSCheckPermissivePattern(t *testing.T) {
+	s, _ := statsd.NewNoopClient()
+	cl := &predictableClient{arn: "arn:aws:sts::123456789012:assumed-role/nodes/i-0123456789abcdef0"}
+	check, err := New("permissive", s, Client(cl), RolePattern(".*"))
+	if err != nil {
+		t.Fatalf("New(permissive, RolePattern(\".*\")): %v", err)
+	}
+	if err := check.Check(); err == nil {
+		t.Errorf("permissive: got no error, wanted check to fail for ARN %q", cl.arn)
+	}
+}
+
+func TestSTSCheckBadPattern(t *testing.T) {
+	s, _ := statsd.NewNoopClient()
+	if _, err := New("badpattern", s, Client(&predictableClient{}), RolePattern("(")); err == nil {
+		t.Error("New(badpattern, RolePattern(\"(\")): want error, got nil")
+	}
+}
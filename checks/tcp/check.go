@@ -0,0 +1,323 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	metricSucceeded        string = "succeeded"
+	metricFailed           string = "failed"
+	metricConnectLatency   string = "connect.latency"
+	metricHandshakeLatency string = "handshake.latency"
+
+	cfgTargets            string = "TARGETS"
+	cfgTLS                string = "TLS"
+	cfgServerName         string = "SERVER_NAME"
+	cfgCAFile             string = "CA_FILE"
+	cfgInsecureSkipVerify string = "INSECURE_SKIP_VERIFY"
+	cfgTimeout            string = "TIMEOUT"
+
+	defaultTargets            string = ""
+	defaultTLS                string = "false"
+	defaultServerName         string = ""
+	defaultCAFile             string = ""
+	defaultInsecureSkipVerify string = "false"
+	defaultTimeout            string = "2s"
+)
+
+// Reasons a target may be unreachable. Each is emitted as a distinct metric.
+const (
+	ReasonRefused string = "refused"
+	ReasonTimeout string = "timeout"
+	ReasonDNS     string = "dns"
+	ReasonCert    string = "cert"
+	ReasonOther   string = "other"
+)
+
+type check struct {
+	name    string
+	stats   statsd.SubStatter
+	log     *zap.Logger
+	targets []string
+	tls     *tls.Config
+	useTLS  bool
+	timeout time.Duration
+}
+
+// An Option represents a TCP checker option.
+type Option func(*check) error
+
+// Logger allows the use of a bespoke Zap logger.
+func Logger(l *zap.Logger) Option {
+	return func(c *check) error {
+		c.log = l
+		return nil
+	}
+}
+
+// Target adds a host:port target to dial.
+func Target(addr string) Option {
+	return func(c *check) error {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return errors.Wrapf(err, "cannot parse target %s", addr)
+		}
+		c.targets = append(c.targets, addr)
+		return nil
+	}
+}
+
+// TLS determines whether a TLS handshake is performed after connecting.
+func TLS(t bool) Option {
+	return func(c *check) error {
+		c.useTLS = t
+		return nil
+	}
+}
+
+// ServerName sets the TLS server name used for SNI and certificate
+// verification. Each target's host is used by default.
+func ServerName(n string) Option {
+	return func(c *check) error {
+		c.tls.ServerName = n
+		return nil
+	}
+}
+
+// CAFile causes TLS certificates to be verified against the PEM encoded
+// certificate authorities in the supplied file rather than the system pool.
+func CAFile(f string) Option {
+	return func(c *check) error {
+		if f == "" {
+			return nil
+		}
+		pem, err := ioutil.ReadFile(f)
+		if err != nil {
+			return errors.Wrapf(err, "cannot read CA file %s", f)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("cannot parse CA file %s", f)
+		}
+		c.tls.RootCAs = pool
+		return nil
+	}
+}
+
+// InsecureSkipVerify disables TLS certificate verification.
+func InsecureSkipVerify(skip bool) Option {
+	return func(c *check) error {
+		c.tls.InsecureSkipVerify = skip
+		return nil
+	}
+}
+
+// Timeout sets the longest connecting to and handshaking with any one target
+// may take.
+func Timeout(t time.Duration) Option {
+	return func(c *check) error {
+		c.timeout = t
+		return nil
+	}
+}
+
+// New returns a Checker that checks whether the supplied TCP targets accept
+// connections and, optionally, TLS handshakes.
+func New(name string, s statsd.Statter, co ...Option) (kubernary.Checker, error) {
+	l, err := zap.NewProduction()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot create default logger")
+	}
+
+	cfg := map[string]string{
+		cfgTargets:            defaultTargets,
+		cfgTLS:                defaultTLS,
+		cfgServerName:         defaultServerName,
+		cfgCAFile:             defaultCAFile,
+		cfgInsecureSkipVerify: defaultInsecureSkipVerify,
+		cfgTimeout:            defaultTimeout,
+	}
+	cfg = kubernary.CheckConfigFromEnv(name, cfg)
+
+	useTLS, err := strconv.ParseBool(cfg[cfgTLS])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTLS)
+	}
+	skip, err := strconv.ParseBool(cfg[cfgInsecureSkipVerify])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgInsecureSkipVerify)
+	}
+	timeout, err := time.ParseDuration(cfg[cfgTimeout])
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot parse %s", cfgTimeout)
+	}
+
+	c := &check{
+		name:    name,
+		stats:   s.NewSubStatter(name),
+		log:     l,
+		tls:     &tls.Config{},
+		timeout: timeout,
+	}
+
+	env := []Option{TLS(useTLS), ServerName(cfg[cfgServerName]), CAFile(cfg[cfgCAFile]), InsecureSkipVerify(skip)}
+	for _, t := range kubernary.SplitConfigValue(cfg[cfgTargets]) {
+		env = append(env, Target(t))
+	}
+
+	for _, o := range append(env, co...) {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply TCP Checker option")
+		}
+	}
+
+	if len(c.targets) == 0 {
+		return nil, errors.New("TCP Checker requires at least one target")
+	}
+
+	c.log = c.log.With(zap.String("checkName", c.name), zap.Bool("tls", c.useTLS))
+
+	return c, nil
+}
+
+// metricName converts a host:port target into a single statsd metric path
+// component.
+func metricName(target string) string {
+	return strings.NewReplacer(".", "_", ":", "_").Replace(target)
+}
+
+// An unwrapper is an error that wraps another, e.g. the error returned when
+// newer versions of crypto/tls fail to verify a certificate.
+type unwrapper interface {
+	Unwrap() error
+}
+
+// reason classifies why a connection or handshake failed.
+func reason(err error) string {
+	for err != nil {
+		err = errors.Cause(err)
+		switch e := err.(type) {
+		case *net.DNSError:
+			return ReasonDNS
+		case x509.HostnameError, x509.UnknownAuthorityError, x509.CertificateInvalidError:
+			return ReasonCert
+		case syscall.Errno:
+			if e == syscall.ECONNREFUSED {
+				return ReasonRefused
+			}
+			return ReasonOther
+		case *net.OpError:
+			if e.Timeout() {
+				return ReasonTimeout
+			}
+			err = e.Err
+		case *os.SyscallError:
+			err = e.Err
+		case net.Error:
+			if e.Timeout() {
+				return ReasonTimeout
+			}
+			return ReasonOther
+		case unwrapper:
+			err = e.Unwrap()
+		default:
+			return ReasonOther
+		}
+	}
+	return ReasonOther
+}
+
+func (c *check) timing(metric string, d time.Duration) {
+	if err := c.stats.TimingDuration(metric, d, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) inc(metric string) {
+	if err := c.stats.Inc(metric, 1, 1.0); err != nil {
+		c.log.Error("cannot emit metric", zap.String("metric", metric), zap.Error(err))
+	}
+}
+
+func (c *check) checkTarget(ctx context.Context, target string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	started := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", target)
+	if err != nil {
+		return errors.Wrap(err, "cannot connect")
+	}
+	defer conn.Close()
+	c.timing(metricName(target)+"."+metricConnectLatency, time.Since(started))
+
+	if !c.useTLS {
+		return nil
+	}
+
+	cfg := c.tls.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName, _, _ = net.SplitHostPort(target)
+	}
+	if d, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(d); err != nil {
+			return errors.Wrap(err, "cannot set connection deadline")
+		}
+	}
+	started = time.Now()
+	if err := tls.Client(conn, cfg).Handshake(); err != nil {
+		return errors.Wrap(err, "cannot complete TLS handshake")
+	}
+	c.timing(metricName(target)+"."+metricHandshakeLatency, time.Since(started))
+	return nil
+}
+
+func (c *check) checkTargets(ctx context.Context) error {
+	failures := []string{}
+	for _, t := range c.targets {
+		if err := c.checkTarget(ctx, t); err != nil {
+			r := reason(err)
+			c.inc(metricName(t) + "." + metricFailed + "." + r)
+			c.log.Error("target check failed", zap.String("target", t), zap.String("reason", r), zap.Error(err))
+			failures = append(failures, t+" ("+r+"): "+err.Error())
+			continue
+		}
+		c.inc(metricName(t) + "." + metricSucceeded)
+	}
+	if len(failures) > 0 {
+		return errors.Errorf("%d targets failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (c *check) Check() error {
+	return c.CheckContext(context.Background())
+}
+
+// CheckContext connects to the configured targets, abandoning any connection
+// in progress when the supplied context is done.
+func (c *check) CheckContext(ctx context.Context) error {
+	if err := c.checkTargets(ctx); err != nil {
+		return errors.Wrapf(err, "%s connect check failed", c.name)
+	}
+	c.log.Debug("connect check succeeded")
+	return nil
+}
+
+func (c *check) Name() string {
+	return c.name
+}
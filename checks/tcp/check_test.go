@@ -0,0 +1,115 @@
+package tcp
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+func TestTCPCheck(t *testing.T) {
+	l, err := zap.NewDevelopment()
+	if err != nil {
+		t.Fatalf("zap.NewDevelopment(): %v", err)
+	}
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "https://")
+
+	ca, err := ioutil.TempFile("", "kubernary-tcp-ca")
+	if err != nil {
+		t.Fatalf("ioutil.TempFile(): %v", err)
+	}
+	defer os.Remove(ca.Name())
+	if err := pem.Encode(ca, &pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}); err != nil {
+		t.Fatalf("pem.Encode(): %v", err)
+	}
+	ca.Close()
+
+	// Grab a free port, then close its listener so connections are refused.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %v", err)
+	}
+	refused := closed.Addr().String()
+	closed.Close()
+
+	cases := []struct {
+		name    string
+		o       []Option
+		wantErr bool
+	}{
+		{name: "connect", o: []Option{Target(addr)}},
+		{name: "refused", o: []Option{Target(refused)}, wantErr: true},
+		{name: "tls", o: []Option{Target(addr), TLS(true), CAFile(ca.Name()), ServerName("example.com")}},
+		{name: "tlsuntrusted", o: []Option{Target(addr), TLS(true), ServerName("example.com")}, wantErr: true},
+		{name: "tlswrongname", o: []Option{Target(addr), TLS(true), CAFile(ca.Name()), ServerName("kubernary.example.org")}, wantErr: true},
+		{name: "tlsinsecure", o: []Option{Target(addr), TLS(true), InsecureSkipVerify(true)}},
+	}
+
+	for _, tt := range cases {
+		// NewNoopClient never returns an error.
+		s, _ := statsd.NewNoopClient()
+		o := append([]Option{Logger(l)}, tt.o...)
+
+		check, err := New(tt.name, s, o...)
+		if err != nil {
+			t.Errorf("New(%v, %v, %v): %v", tt.name, s, o, err)
+			continue
+		}
+
+		err = check.Check()
+		if tt.wantErr && err == nil {
+			t.Errorf("%s: got no error, wanted check to fail", tt.name)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: got %v, did not want error.", tt.name, err)
+		}
+	}
+}
+
+func TestReason(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %v", err)
+	}
+	refused := closed.Addr().String()
+	closed.Close()
+
+	s, _ := statsd.NewNoopClient()
+	c, err := New("reason", s, Target(refused))
+	if err != nil {
+		t.Fatalf("New(reason, %v, Target(%v)): %v", s, refused, err)
+	}
+	err = c.(*check).checkTarget(context.Background(), refused)
+	if got := reason(err); got != ReasonRefused {
+		t.Errorf("reason(%v): want %s, got %s", err, ReasonRefused, got)
+	}
+
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	untrusted := strings.TrimPrefix(srv.URL, "https://")
+	c, err = New("reason", s, Target(untrusted), TLS(true), ServerName("example.com"))
+	if err != nil {
+		t.Fatalf("New(reason, %v, Target(%v), TLS(true)): %v", s, untrusted, err)
+	}
+	err = c.(*check).checkTarget(context.Background(), untrusted)
+	if got := reason(err); got != ReasonCert {
+		t.Errorf("reason(%v): want %s, got %s", err, ReasonCert, got)
+	}
+
+	dnsErr := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "nope.invalid", IsNotFound: true}}
+	if got := reason(dnsErr); got != ReasonDNS {
+		t.Errorf("reason(%v): want %s, got %s", dnsErr, ReasonDNS, got)
+	}
+}
@@ -1,22 +1,56 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/negz/kubernary"
+	"github.com/negz/kubernary/aggregate"
+	"github.com/negz/kubernary/checks/certexpiry"
+	"github.com/negz/kubernary/checks/dns"
+	grpccheck "github.com/negz/kubernary/checks/grpc"
+	httpcheck "github.com/negz/kubernary/checks/http"
+	"github.com/negz/kubernary/checks/imds"
+	"github.com/negz/kubernary/checks/kubeapi"
+	"github.com/negz/kubernary/checks/mesh"
+	"github.com/negz/kubernary/checks/podlaunch"
+	"github.com/negz/kubernary/checks/pvc"
 	"github.com/negz/kubernary/checks/s3"
+	"github.com/negz/kubernary/checks/service"
+	"github.com/negz/kubernary/checks/sts"
+	"github.com/negz/kubernary/checks/tcp"
+	"github.com/negz/kubernary/dogstatsd"
+	"github.com/negz/kubernary/grpchealth"
+	"github.com/negz/kubernary/kube"
+	"github.com/negz/kubernary/telemetry"
 
 	"github.com/cactus/go-statsd-client/statsd"
 	"github.com/facebookgo/httpdown"
 	"github.com/julienschmidt/httprouter"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
-const statsPrefix string = "kubernary"
+const (
+	statsPrefix string = "kubernary"
+
+	// historySize is the number of results per check shown on the status page.
+	historySize   = 60
+	statusRefresh = 10 * time.Second
+
+	// telemetryShutdownTimeout is the longest we'll wait to flush spans and
+	// metrics at shutdown.
+	telemetryShutdownTimeout = 10 * time.Second
+)
 
 func setupS3Check(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
 	check, err := s3.New("s3", s, s3.Logger(log))
@@ -24,9 +58,127 @@ func setupS3Check(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
 	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
 }
 
-// TODO(negz): Find a better pattern for including and configuring checks.
-func setupChecks(log *zap.Logger, s statsd.Statter) []*kubernary.CheckConfig {
-	return []*kubernary.CheckConfig{setupS3Check(log, s)}
+func setupSTSCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := sts.New("sts", s, sts.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup STS check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
+}
+
+func setupIMDSCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := imds.New("imds", s, imds.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup instance metadata service check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
+}
+
+func setupHTTPCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := httpcheck.New("http", s, httpcheck.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup HTTP check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
+}
+
+func setupGRPCCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := grpccheck.New("grpc", s, grpccheck.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup gRPC check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 10 * time.Second}
+}
+
+func setupDNSCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := dns.New("dns", s, dns.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup DNS check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
+}
+
+func setupTCPCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := tcp.New("tcp", s, tcp.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup TCP check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 2 * time.Second}
+}
+
+func setupCertExpiryCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := certexpiry.New("certexpiry", s, certexpiry.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup certificate expiry check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 1 * time.Hour, Timeout: 10 * time.Second}
+}
+
+func setupKubeAPICheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := kubeapi.New("kubeapi", s, kubeapi.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup Kubernetes API check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 10 * time.Second}
+}
+
+func setupPodLaunchCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := podlaunch.New("podlaunch", s, podlaunch.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup pod launch check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 5 * time.Minute, Timeout: 3 * time.Minute, BackgroundOnly: true}
+}
+
+func setupServiceCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := service.New("service", s, service.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup Service check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 10 * time.Second}
+}
+
+func setupPVCCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := pvc.New("pvc", s, pvc.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup persistent volume check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 10 * time.Minute, Timeout: 6 * time.Minute, BackgroundOnly: true}
+}
+
+func setupMeshCheck(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig {
+	check, err := mesh.New("mesh", s, mesh.Logger(log))
+	kingpin.FatalIfError(err, "cannot setup mesh check")
+	return &kubernary.CheckConfig{Checker: check, Interval: 30 * time.Second, Timeout: 10 * time.Second}
+}
+
+type setupFn func(log *zap.Logger, s statsd.Statter) *kubernary.CheckConfig
+
+var setups = map[string]setupFn{
+	"s3":         setupS3Check,
+	"sts":        setupSTSCheck,
+	"imds":       setupIMDSCheck,
+	"http":       setupHTTPCheck,
+	"grpc":       setupGRPCCheck,
+	"dns":        setupDNSCheck,
+	"tcp":        setupTCPCheck,
+	"certexpiry": setupCertExpiryCheck,
+	"kubeapi":    setupKubeAPICheck,
+	"podlaunch":  setupPodLaunchCheck,
+	"service":    setupServiceCheck,
+	"pvc":        setupPVCCheck,
+	"mesh":       setupMeshCheck,
+}
+
+func checkNames() []string {
+	names := make([]string, 0, len(setups))
+	for name := range setups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// unique returns the supplied check names without duplicates, in the order
+// they were first supplied.
+func unique(names []string) []string {
+	seen := map[string]bool{}
+	u := make([]string, 0, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		u = append(u, name)
+	}
+	return u
+}
+
+// TODO(negz): Find a better pattern for configuring checks.
+func setupChecks(log *zap.Logger, s statsd.Statter, names []string) []*kubernary.CheckConfig {
+	cfgs := make([]*kubernary.CheckConfig, 0, len(names))
+	for _, name := range names {
+		cfgs = append(cfgs, setups[name](log, s))
+	}
+	return cfgs
 }
 
 func logReq(fn http.HandlerFunc, log *zap.Logger) http.HandlerFunc {
@@ -41,17 +193,31 @@ func logReq(fn http.HandlerFunc, log *zap.Logger) http.HandlerFunc {
 
 func main() {
 	var (
-		app    = kingpin.New(filepath.Base(os.Args[0]), "Checks whether your Kubernetes cluster works.").DefaultEnvars()
+		app    = kingpin.New(filepath.Base(os.Args[0]), "Checks whether your Kubernetes cluster works.").DefaultEnvars().Version(kubernary.Version)
 		stats  = app.Arg("statsd", "Address to which to send statsd metrics.").Required().String()
 		nosend = app.Flag("no-stats", "Don't send statsd stats.").Bool()
 		listen = app.Flag("listen", "Address at which to expose HTTP health checks.").Default(":10002").String()
 		debug  = app.Flag("debug", "Run with debug logging.").Short('d').Bool()
 		stop   = app.Flag("close-after", "Wait this long at shutdown before closing HTTP connections.").Default("1m").Duration()
 		kill   = app.Flag("kill-after", "Wait this long at shutdown before exiting.").Default("2m").Duration()
+		checks = app.Flag("check", "Run this check. May be repeated.").Default("s3").Enums(checkNames()...)
+		topo   = app.Flag("node-topology", "Look up the zone of the node kubernary runs on from its topology labels.").Bool()
+		tags   = app.Flag("stats-tags", "Tag statsd metrics with check, type, node, zone, pod, namespace, and failure category using DogStatsD tags.").Bool()
+		flush  = app.Flag("stats-flush-interval", "Buffer statsd metrics for this long before sending them.").Default("1s").Duration()
+		gaddr  = app.Flag("grpc-listen", "Address at which to serve the gRPC health checking protocol. Disabled if unset.").String()
+		agg    = app.Flag("aggregate", "Serve the combined results of all kubernary instances in the cluster.").Bool()
+		otlp   = app.Flag("otlp-endpoint", "Address of an OTLP gRPC collector to which to export traces and metrics of check runs. Disabled if unset.").String()
+		hdrs   = app.Flag("otlp-header", "Send this header with each OTLP export, i.e. KEY=VALUE. May be repeated.").StringMap()
+		every  = app.Flag("otlp-interval", "Export OTLP metrics this often.").Default("1m").Duration()
+		insec  = app.Flag("otlp-insecure", "Export to the OTLP collector via plain gRPC rather than TLS.").Bool()
 	)
 
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 
+	// Each check may only run once; checks that serve HTTP are routed by
+	// name, and httprouter panics on duplicate routes.
+	*checks = unique(*checks)
+
 	var log *zap.Logger
 	log, err := zap.NewProduction()
 	if *debug {
@@ -59,22 +225,135 @@ func main() {
 	}
 	kingpin.FatalIfError(err, "cannot create logger")
 
-	s, err := statsd.NewNoopClient(*stats, statsPrefix)
-	if !*nosend {
-		s, err = statsd.NewClient(*stats, statsPrefix)
+	node := kubernary.NodeFromEnv()
+	if *topo && node.Name != "" {
+		k, err := kube.InClusterClient()
+		kingpin.FatalIfError(err, "cannot create Kubernetes client")
+		node.Zone, err = kube.Zone(context.Background(), k, node.Name)
+		kingpin.FatalIfError(err, "cannot determine node zone")
+	}
+	labels := node.Labels()
+	for k, v := range labels {
+		log = log.With(zap.String(k, v))
+	}
+
+	var s statsd.Statter
+	if *nosend {
+		s, err = statsd.NewNoopClient(*stats, statsPrefix)
+	} else if *tags {
+		var sender statsd.Sender
+		sender, err = statsd.NewSimpleSender(*stats)
+		kingpin.FatalIfError(err, "cannot create statsd sender")
+
+		// Each check is named after its type.
+		types := map[string]string{}
+		for _, name := range *checks {
+			types[name] = name
+		}
+		s, err = dogstatsd.New(sender, statsPrefix, dogstatsd.Tags(labels), dogstatsd.CheckTypes(types), dogstatsd.FlushInterval(*flush))
+	} else {
+		s, err = statsd.NewBufferedClient(*stats, statsPrefix, *flush, 0)
 	}
 	kingpin.FatalIfError(err, "cannot create statsd client")
 
-	cfgs := setupChecks(log, s)
+	var (
+		mr        *telemetry.MetricsRecorder
+		shutdowns []func(context.Context) error
+	)
+	if *otlp != "" {
+		to := []telemetry.Option{telemetry.Endpoint(*otlp), telemetry.Headers(*hdrs), telemetry.Interval(*every), telemetry.Node(node)}
+		if *insec {
+			to = append(to, telemetry.Insecure())
+		}
+		tp, err := telemetry.NewTracerProvider(context.Background(), to...)
+		kingpin.FatalIfError(err, "cannot create tracer provider")
+		otel.SetTracerProvider(tp)
+		shutdowns = append(shutdowns, tp.Shutdown)
+
+		mp, err := telemetry.NewMeterProvider(context.Background(), to...)
+		kingpin.FatalIfError(err, "cannot create meter provider")
+		shutdowns = append(shutdowns, mp.Shutdown)
+		mr, err = telemetry.NewMetricsRecorder(mp)
+		kingpin.FatalIfError(err, "cannot create metrics recorder")
+	}
+
+	cfgs := setupChecks(log, s, *checks)
+	for _, cfg := range cfgs {
+		cfg.Node = node
+	}
+
+	events := kubernary.NewBroadcaster()
+	history := kubernary.NewHistory(historySize)
+	recorders := []kubernary.Recorder{events, history, kubernary.NewStatsRecorder(s)}
+	if mr != nil {
+		recorders = append(recorders, mr)
+	}
+	stopGRPC := func() {}
+	if *gaddr != "" {
+		names := make([]string, 0, len(cfgs))
+		for _, cfg := range cfgs {
+			names = append(names, cfg.Checker.Name())
+		}
+		hs := health.NewServer()
+		recorders = append(recorders, grpchealth.NewRecorder(hs, names...))
+
+		gs := grpc.NewServer()
+		healthpb.RegisterHealthServer(gs, hs)
+		l, err := net.Listen("tcp", *gaddr)
+		kingpin.FatalIfError(err, "cannot listen for gRPC")
+		go func() { kingpin.FatalIfError(gs.Serve(l), "gRPC server error") }()
 
-	cancel := kubernary.RunChecksForever(cfgs)
+		// Tell watchers we're going away before we stop serving them.
+		stopGRPC = func() {
+			hs.Shutdown()
+			gs.GracefulStop()
+		}
+	}
+
+	stopChecks := kubernary.RunChecksForever(cfgs, recorders...)
+
+	// Stop running checks and serving their results, then flush any stats,
+	// spans and metrics they produced.
+	cancel := func() {
+		stopChecks()
+		stopGRPC()
+		if err := s.Close(); err != nil {
+			log.Error("cannot close statsd client", zap.Error(err))
+		}
+		ctx, done := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+		defer done()
+		for _, shutdown := range shutdowns {
+			if err := shutdown(ctx); err != nil {
+				log.Error("cannot shutdown telemetry", zap.Error(err))
+			}
+		}
+	}
 
 	r := httprouter.New()
-	r.HandlerFunc("GET", "/health", logReq(kubernary.ChecksHandler(cfgs), log))
+	r.HandlerFunc("GET", "/health", logReq(kubernary.ChecksHandler(cfgs, kubernary.WithHistory(history)), log))
 	r.HandlerFunc("GET", "/quitquitquit", logReq(kubernary.ShutdownHandler(cancel), log))
+	r.HandlerFunc("GET", "/", logReq(kubernary.StatusHandler(cfgs, history, statusRefresh), log))
+	r.HandlerFunc("GET", "/status", logReq(kubernary.StatusHandler(cfgs, history, statusRefresh), log))
+	r.HandlerFunc("GET", "/events", logReq(kubernary.EventsHandler(events, 15*time.Second), log))
+
+	// Peers ping each other constantly, so we don't log pings.
+	r.HandlerFunc("GET", "/ping", kubernary.PingHandler())
+	for _, cfg := range cfgs {
+		if h, ok := cfg.Checker.(kubernary.HandlerChecker); ok {
+			r.HandlerFunc("GET", "/"+h.Name(), logReq(h.Handler(), log))
+		}
+	}
+
+	if *agg {
+		a, err := aggregate.New(aggregate.Logger(log))
+		kingpin.FatalIfError(err, "cannot setup aggregator")
+		r.HandlerFunc("GET", "/cluster", logReq(a.Handler(), log))
+	}
 
 	hd := &httpdown.HTTP{StopTimeout: *stop, KillTimeout: *kill}
 	http := &http.Server{Addr: *listen, Handler: r}
 
-	kingpin.FatalIfError(httpdown.ListenAndServe(http, hd), "HTTP server error")
+	err = httpdown.ListenAndServe(http, hd)
+	cancel()
+	kingpin.FatalIfError(err, "HTTP server error")
 }
@@ -0,0 +1,384 @@
+// Package dogstatsd supports the DogStatsD extensions to the statsd protocol.
+package dogstatsd
+
+import (
+	"bytes"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxPacketBytes is the largest UDP packet we'll send; small enough to avoid
+	// fragmentation on most networks.
+	maxPacketBytes = 1432
+
+	defaultFlushInterval = 1 * time.Second
+
+	// TagCheck is the tag identifying the check that emitted a metric.
+	TagCheck string = "check"
+	// TagType is the tag identifying the type of check that emitted a metric.
+	TagType string = "type"
+)
+
+// sanitize removes characters that would corrupt a DogStatsD tag. Tag keys
+// must additionally not contain a colon.
+var sanitize = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// A Tag is a DogStatsD tag.
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// A Tagger can send metrics with additional DogStatsD tags.
+type Tagger interface {
+	Tagged(tags ...Tag) statsd.SubStatter
+}
+
+// Inc increments the supplied stat by v. The supplied tags are sent as
+// DogStatsD tags if s is a Tagger, or otherwise appended to the stat's name,
+// i.e. stat.value.
+func Inc(s statsd.StatSender, stat string, v int64, rate float32, tags ...Tag) error {
+	if t, ok := s.(Tagger); ok {
+		return t.Tagged(tags...).Inc(stat, v, rate)
+	}
+	for _, t := range tags {
+		stat = stat + "." + t.Value
+	}
+	return s.Inc(stat, v, rate)
+}
+
+type key struct {
+	name   string
+	suffix string
+}
+
+// A buffer aggregates counters and batches all other metrics until flushed.
+type buffer struct {
+	sender statsd.Sender
+	m      sync.Mutex
+	counts map[key]int64
+	lines  []string
+}
+
+func (b *buffer) count(k key, v int64) {
+	b.m.Lock()
+	b.counts[k] += v
+	b.m.Unlock()
+}
+
+func (b *buffer) add(line string) {
+	b.m.Lock()
+	b.lines = append(b.lines, line)
+	b.m.Unlock()
+}
+
+// flush sends all buffered metrics in as few packets as possible.
+func (b *buffer) flush() error {
+	b.m.Lock()
+	lines := b.lines
+	for k, v := range b.counts {
+		lines = append(lines, k.name+":"+strconv.FormatInt(v, 10)+k.suffix)
+	}
+	b.lines, b.counts = nil, map[key]int64{}
+	b.m.Unlock()
+
+	sort.Strings(lines)
+	var err error
+	p := &bytes.Buffer{}
+	send := func() {
+		if _, serr := b.sender.Send(p.Bytes()); serr != nil && err == nil {
+			err = errors.Wrap(serr, "cannot send metrics")
+		}
+		p.Reset()
+	}
+	for _, l := range lines {
+		if p.Len() > 0 && p.Len()+1+len(l) > maxPacketBytes {
+			send()
+		}
+		if p.Len() > 0 {
+			p.WriteByte('\n')
+		}
+		p.WriteString(l)
+	}
+	if p.Len() > 0 {
+		send()
+	}
+	return err
+}
+
+// A Client is a statsd.Statter that sends metrics with DogStatsD tags. Rather
+// than prefixing metric names, sub statters tag their metrics with the name
+// of the check that created them, and its type. Counters are aggregated and
+// all metrics are buffered until flushed.
+type Client struct {
+	buf      *buffer
+	prefix   string
+	tags     map[string]string
+	types    map[string]string
+	sub      bool
+	root     bool
+	once     *sync.Once
+	sampler  statsd.SamplerFunc
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// An Option represents a DogStatsD client option.
+type Option func(*Client) error
+
+// Tags are sent with every metric.
+func Tags(tags map[string]string) Option {
+	return func(c *Client) error {
+		for k, v := range tags {
+			c.tags[k] = v
+		}
+		return nil
+	}
+}
+
+// CheckTypes maps the names of checks to their types. Metrics sent by a sub
+// statter named after a check are tagged with the check's type.
+func CheckTypes(types map[string]string) Option {
+	return func(c *Client) error {
+		c.types = types
+		return nil
+	}
+}
+
+// FlushInterval sets how often buffered metrics are sent. Metrics are sent
+// immediately if the interval is zero.
+func FlushInterval(d time.Duration) Option {
+	return func(c *Client) error {
+		if d < 0 {
+			return errors.Errorf("flush interval cannot be negative, got %s", d)
+		}
+		c.interval = d
+		return nil
+	}
+}
+
+// New returns a DogStatsD client that sends metrics with the supplied prefix
+// via the supplied sender.
+func New(s statsd.Sender, prefix string, co ...Option) (*Client, error) {
+	c := &Client{
+		buf:      &buffer{sender: s, counts: map[key]int64{}},
+		prefix:   prefix,
+		tags:     map[string]string{},
+		types:    map[string]string{},
+		sampler:  sample,
+		interval: defaultFlushInterval,
+		root:     true,
+		once:     &sync.Once{},
+		stop:     make(chan struct{}),
+	}
+	for _, o := range co {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply DogStatsD client option")
+		}
+	}
+	if c.interval > 0 {
+		go c.flushEvery(c.interval)
+	}
+	return c, nil
+}
+
+func sample(rate float32) bool {
+	return rand.Float32() < rate
+}
+
+func (c *Client) flushEvery(d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			// There is nothing for us to do with an error in this context.
+			c.buf.flush() // nolint: errcheck
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+func (c *Client) with(tags map[string]string) *Client {
+	n := *c
+	n.root = false
+	n.tags = make(map[string]string, len(c.tags)+len(tags))
+	for k, v := range c.tags {
+		n.tags[k] = v
+	}
+	for k, v := range tags {
+		n.tags[k] = v
+	}
+	return &n
+}
+
+func (c *Client) suffix(kind string, rate float32) string {
+	b := &strings.Builder{}
+	if kind != "" {
+		b.WriteString("|" + kind)
+	}
+	if rate < 1 {
+		b.WriteString("|@" + strconv.FormatFloat(float64(rate), 'f', -1, 32))
+	}
+	if len(c.tags) > 0 {
+		t := make([]string, 0, len(c.tags))
+		for k, v := range c.tags {
+			t = append(t, strings.Replace(sanitize.Replace(k), ":", "_", -1)+":"+sanitize.Replace(v))
+		}
+		sort.Strings(t)
+		b.WriteString("|#" + strings.Join(t, ","))
+	}
+	return b.String()
+}
+
+func (c *Client) name(stat string) string {
+	if c.prefix == "" {
+		return stat
+	}
+	return c.prefix + "." + stat
+}
+
+func (c *Client) submit(stat, value, kind string, rate float32) error {
+	if rate < 1 && !c.sampler(rate) {
+		return nil
+	}
+	c.buf.add(c.name(stat) + ":" + value + c.suffix(kind, rate))
+	return c.flushIfUnbuffered()
+}
+
+func (c *Client) count(stat string, v int64, rate float32) error {
+	if rate < 1 && !c.sampler(rate) {
+		return nil
+	}
+	c.buf.count(key{name: c.name(stat), suffix: c.suffix("c", rate)}, v)
+	return c.flushIfUnbuffered()
+}
+
+func (c *Client) flushIfUnbuffered() error {
+	if c.interval > 0 {
+		return nil
+	}
+	return c.buf.flush()
+}
+
+// Inc increments a counter.
+func (c *Client) Inc(stat string, v int64, rate float32) error {
+	return c.count(stat, v, rate)
+}
+
+// Dec decrements a counter.
+func (c *Client) Dec(stat string, v int64, rate float32) error {
+	return c.count(stat, -v, rate)
+}
+
+// Gauge sets a gauge.
+func (c *Client) Gauge(stat string, v int64, rate float32) error {
+	return c.submit(stat, strconv.FormatInt(v, 10), "g", rate)
+}
+
+// GaugeDelta adjusts a gauge by v.
+func (c *Client) GaugeDelta(stat string, v int64, rate float32) error {
+	value := strconv.FormatInt(v, 10)
+	if v >= 0 {
+		value = "+" + value
+	}
+	return c.submit(stat, value, "g", rate)
+}
+
+// Timing records a timing in milliseconds.
+func (c *Client) Timing(stat string, v int64, rate float32) error {
+	return c.submit(stat, strconv.FormatInt(v, 10), "ms", rate)
+}
+
+// TimingDuration records a timing.
+func (c *Client) TimingDuration(stat string, d time.Duration, rate float32) error {
+	ms := float64(d) / float64(time.Millisecond)
+	return c.submit(stat, strconv.FormatFloat(ms, 'f', -1, 64), "ms", rate)
+}
+
+// Set adds a value to a set.
+func (c *Client) Set(stat string, v string, rate float32) error {
+	return c.submit(stat, v, "s", rate)
+}
+
+// SetInt adds a value to a set.
+func (c *Client) SetInt(stat string, v int64, rate float32) error {
+	return c.submit(stat, strconv.FormatInt(v, 10), "s", rate)
+}
+
+// Raw sends a value that already includes its metric type, i.e. 1|c.
+func (c *Client) Raw(stat string, v string, rate float32) error {
+	return c.submit(stat, v, "", rate)
+}
+
+// Tagged returns a sub statter that adds the supplied tags to its metrics.
+func (c *Client) Tagged(tags ...Tag) statsd.SubStatter {
+	t := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		t[tag.Key] = tag.Value
+	}
+	return c.with(t)
+}
+
+// NewSubStatter returns a sub statter. The first sub statter in a chain tags
+// its metrics with the supplied name and its check type. Its own sub statters
+// prefix their metric names with the supplied name.
+func (c *Client) NewSubStatter(name string) statsd.SubStatter {
+	if c.sub {
+		n := c.with(nil)
+		n.prefix = c.name(name)
+		return n
+	}
+	tags := map[string]string{TagCheck: name}
+	if t, ok := c.types[name]; ok {
+		tags[TagType] = t
+	}
+	n := c.with(tags)
+	n.sub = true
+	return n
+}
+
+// SetPrefix sets the prefix of all metric names.
+func (c *Client) SetPrefix(prefix string) {
+	c.prefix = prefix
+}
+
+// SetSamplerFunc sets the function used to sample metrics sent with a rate
+// below 1.
+func (c *Client) SetSamplerFunc(f statsd.SamplerFunc) {
+	c.sampler = f
+}
+
+// Flush sends all buffered metrics.
+func (c *Client) Flush() error {
+	return c.buf.flush()
+}
+
+// Close flushes all buffered metrics. Closing the client returned by New
+// also stops periodic flushing and closes the underlying sender; subsequent
+// calls do nothing. Closing a sub statter only flushes buffered metrics.
+func (c *Client) Close() error {
+	if !c.root {
+		return c.buf.flush()
+	}
+	var err error
+	c.once.Do(func() {
+		if c.interval > 0 {
+			close(c.stop)
+		}
+		err = c.buf.flush()
+		if cerr := c.buf.sender.Close(); cerr != nil && err == nil {
+			err = errors.Wrap(cerr, "cannot close sender")
+		}
+	})
+	return err
+}
@@ -0,0 +1,190 @@
+package dogstatsd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+type recordingSender struct {
+	sent   []string
+	closed int
+}
+
+func (s *recordingSender) Send(data []byte) (int, error) {
+	s.sent = append(s.sent, string(data))
+	return len(data), nil
+}
+
+func (s *recordingSender) Close() error {
+	s.closed++
+	return nil
+}
+
+func newTestClient(t *testing.T, co ...Option) (*Client, *recordingSender) {
+	r := &recordingSender{}
+	c, err := New(r, "kubernary", append([]Option{FlushInterval(0)}, co...)...)
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	return c, r
+}
+
+var clientTests = []struct {
+	name string
+	send func(s statsd.SubStatter)
+	want string
+}{
+	{
+		name: "Counter",
+		send: func(s statsd.SubStatter) { s.Inc("download.succeeded", 1, 1.0) }, // nolint: errcheck
+		want: "kubernary.download.succeeded:1|c|#check:s3,node:node-a,type:s3",
+	},
+	{
+		name: "Tagged",
+		send: func(s statsd.SubStatter) { Inc(s, "download.failed", 1, 1.0, Tag{Key: "category", Value: "auth"}) }, // nolint: errcheck
+		want: "kubernary.download.failed:1|c|#category:auth,check:s3,node:node-a,type:s3",
+	},
+	{
+		name: "Sampled",
+		send: func(s statsd.SubStatter) { s.Timing("latency", 12, 0.5) }, // nolint: errcheck
+		want: "kubernary.latency:12|ms|@0.5|#check:s3,node:node-a,type:s3",
+	},
+	{
+		name: "NestedSubStatter",
+		send: func(s statsd.SubStatter) { s.NewSubStatter("peer").Gauge("up", 1, 1.0) }, // nolint: errcheck
+		want: "kubernary.peer.up:1|g|#check:s3,node:node-a,type:s3",
+	},
+	{
+		name: "GaugeDelta",
+		send: func(s statsd.SubStatter) { s.GaugeDelta("inflight", 2, 1.0) }, // nolint: errcheck
+		want: "kubernary.inflight:+2|g|#check:s3,node:node-a,type:s3",
+	},
+}
+
+func TestClient(t *testing.T) {
+	for _, tt := range clientTests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, r := newTestClient(t, Tags(map[string]string{"node": "node-a"}), CheckTypes(map[string]string{"s3": "s3"}))
+			s := c.NewSubStatter("s3")
+			s.SetSamplerFunc(func(float32) bool { return true })
+			tt.send(s)
+			if len(r.sent) != 1 || r.sent[0] != tt.want {
+				t.Errorf("r.sent: want [%q], got %q", tt.want, r.sent)
+			}
+		})
+	}
+}
+
+func TestClientSampling(t *testing.T) {
+	c, r := newTestClient(t)
+	c.SetSamplerFunc(func(float32) bool { return false })
+	c.Inc("skipped", 1, 0.1)   // nolint: errcheck
+	c.Gauge("skipped", 1, 0.1) // nolint: errcheck
+	c.Inc("unsampled", 1, 1.0) // nolint: errcheck
+	want := []string{"kubernary.unsampled:1|c"}
+	if len(r.sent) != len(want) || r.sent[0] != want[0] {
+		t.Errorf("r.sent: want %q, got %q", want, r.sent)
+	}
+}
+
+func TestClientBuffering(t *testing.T) {
+	r := &recordingSender{}
+	c, err := New(r, "kubernary", FlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	s := c.NewSubStatter("s3")
+	for i := 0; i < 3; i++ {
+		s.Inc("download.succeeded", 1, 1.0) // nolint: errcheck
+	}
+	s.Inc("download.failed", 1, 1.0) // nolint: errcheck
+	s.Timing("latency", 12, 1.0)     // nolint: errcheck
+	if len(r.sent) != 0 {
+		t.Fatalf("r.sent before flush: want none, got %q", r.sent)
+	}
+
+	if err := c.Close(); err != nil {
+		t.Fatalf("c.Close(): %v", err)
+	}
+	want := strings.Join([]string{
+		"kubernary.download.failed:1|c|#check:s3",
+		"kubernary.download.succeeded:3|c|#check:s3",
+		"kubernary.latency:12|ms|#check:s3",
+	}, "\n")
+	if len(r.sent) != 1 || r.sent[0] != want {
+		t.Errorf("r.sent: want [%q], got %q", want, r.sent)
+	}
+}
+
+func TestClientClose(t *testing.T) {
+	r := &recordingSender{}
+	c, err := New(r, "kubernary", FlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("New(): %v", err)
+	}
+	s := c.NewSubStatter("s3").(*Client)
+	s.Inc("download.succeeded", 1, 1.0) // nolint: errcheck
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("s.Close(): %v", err)
+	}
+	if r.closed != 0 {
+		t.Errorf("r.closed after closing sub statter: want 0, got %d", r.closed)
+	}
+	want := "kubernary.download.succeeded:1|c|#check:s3"
+	if len(r.sent) != 1 || r.sent[0] != want {
+		t.Errorf("r.sent: want [%q], got %q", want, r.sent)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := c.Close(); err != nil {
+			t.Fatalf("c.Close(): %v", err)
+		}
+	}
+	if r.closed != 1 {
+		t.Errorf("r.closed: want 1, got %d", r.closed)
+	}
+}
+
+func TestClientPackets(t *testing.T) {
+	c, r := newTestClient(t)
+	c.interval = time.Hour
+	stat := strings.Repeat("x", 100)
+	for i := 0; i < 30; i++ {
+		c.Timing(stat, int64(i), 1.0) // nolint: errcheck
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("c.Flush(): %v", err)
+	}
+	if len(r.sent) < 2 {
+		t.Errorf("r.sent: want multiple packets, got %d", len(r.sent))
+	}
+	lines := 0
+	for _, p := range r.sent {
+		if len(p) > maxPacketBytes {
+			t.Errorf("len(p): want <= %d, got %d", maxPacketBytes, len(p))
+		}
+		lines += strings.Count(p, "\n") + 1
+	}
+	if lines != 30 {
+		t.Errorf("lines: want 30, got %d", lines)
+	}
+}
+
+func TestInc(t *testing.T) {
+	r := &recordingSender{}
+	s, err := statsd.NewClientWithSender(r, "kubernary")
+	if err != nil {
+		t.Fatalf("statsd.NewClientWithSender(): %v", err)
+	}
+	if err := Inc(s.NewSubStatter("s3"), "download.failed", 1, 1.0, Tag{Key: "category", Value: "auth"}); err != nil {
+		t.Fatalf("Inc(): %v", err)
+	}
+	want := "kubernary.s3.download.failed.auth:1|c"
+	if len(r.sent) != 1 || r.sent[0] != want {
+		t.Errorf("r.sent: want [%q], got %q", want, r.sent)
+	}
+}
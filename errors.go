@@ -0,0 +1,114 @@
+package kubernary
+
+import (
+	"context"
+)
+
+// A Category classifies why a check failed.
+type Category string
+
+// Check failure categories.
+const (
+	// CategoryTimeout indicates a check or an operation it performed timed
+	// out.
+	CategoryTimeout Category = "timeout"
+
+	// CategoryAuth indicates a check was not authenticated or authorized.
+	CategoryAuth Category = "auth"
+
+	// CategoryNotFound indicates a check could not find something it expected
+	// to exist.
+	CategoryNotFound Category = "not-found"
+
+	// CategoryNetwork indicates a check could not reach, or was not correctly
+	// served by, a remote service.
+	CategoryNetwork Category = "network"
+
+	// CategoryAssertion indicates a check completed, but the outcome was not
+	// as expected.
+	CategoryAssertion Category = "assertion"
+
+	// CategoryInternal indicates a check failed due to a problem with
+	// kubernary itself, for example invalid configuration.
+	CategoryInternal Category = "internal"
+
+	// CategoryUnknown indicates a check failed for an unclassified reason.
+	CategoryUnknown Category = "unknown"
+)
+
+// A CheckError is an error with structured details about why a check failed.
+type CheckError struct {
+	// Category classifies the failure.
+	Category Category
+
+	// Retryable indicates whether the check may pass if run again without
+	// intervention, for example after a transient network failure.
+	Retryable bool
+
+	// Fields are arbitrary details of the failure, for example the S3 bucket
+	// a check failed to download from.
+	Fields map[string]string
+
+	err error
+}
+
+// NewCheckError returns a CheckError that classifies the supplied error.
+func NewCheckError(c Category, retryable bool, err error) *CheckError {
+	return &CheckError{Category: c, Retryable: retryable, Fields: map[string]string{}, err: err}
+}
+
+// WithField adds a detail to the CheckError, and returns it.
+func (e *CheckError) WithField(k, v string) *CheckError {
+	e.Fields[k] = v
+	return e
+}
+
+func (e *CheckError) Error() string {
+	return e.err.Error()
+}
+
+// Cause returns the error classified by this CheckError.
+func (e *CheckError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns the error classified by this CheckError.
+func (e *CheckError) Unwrap() error {
+	return e.err
+}
+
+// next returns the error that caused the supplied error, or nil.
+func next(err error) error {
+	switch e := err.(type) {
+	case interface{ Cause() error }:
+		return e.Cause()
+	case interface{ Unwrap() error }:
+		return e.Unwrap()
+	}
+	return nil
+}
+
+// AsCheckError returns the first CheckError in the supplied error's chain of
+// causes, if any.
+func AsCheckError(err error) (*CheckError, bool) {
+	for ; err != nil; err = next(err) {
+		if ce, ok := err.(*CheckError); ok {
+			return ce, true
+		}
+	}
+	return nil, false
+}
+
+// CategoryOf returns the category of the supplied error, which is assumed to
+// be non-nil. Errors caused by a context deadline are considered timeouts.
+func CategoryOf(err error) Category {
+	if ce, ok := AsCheckError(err); ok {
+		return ce.Category
+	}
+	for ; err != nil; err = next(err) {
+		if err == context.DeadlineExceeded {
+			return CategoryTimeout
+		}
+	}
+	return CategoryUnknown
+}
@@ -0,0 +1,67 @@
+package kubernary
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+var categoryTests = []struct {
+	name      string
+	err       error
+	want      Category
+	retryable bool
+}{
+	{name: "Opaque", err: errors.New("boom"), want: CategoryUnknown},
+	{name: "Deadline", err: errors.Wrap(context.DeadlineExceeded, "check timed out"), want: CategoryTimeout},
+	{
+		name:      "CheckError",
+		err:       NewCheckError(CategoryNetwork, true, errors.New("connection refused")),
+		want:      CategoryNetwork,
+		retryable: true,
+	},
+	{
+		name: "WrappedCheckError",
+		err:  errors.Wrap(errors.Wrap(NewCheckError(CategoryAuth, false, errors.New("denied")), "cannot download"), "s3 check failed"),
+		want: CategoryAuth,
+	},
+	{
+		name: "CheckErrorCausedByDeadline",
+		err:  NewCheckError(CategoryAssertion, false, context.DeadlineExceeded),
+		want: CategoryAssertion,
+	},
+}
+
+func TestCategoryOf(t *testing.T) {
+	for _, tt := range categoryTests {
+		if got := CategoryOf(tt.err); got != tt.want {
+			t.Errorf("%s: CategoryOf(%v): want %v, got %v", tt.name, tt.err, tt.want, got)
+		}
+		ce, ok := AsCheckError(tt.err)
+		if !ok {
+			continue
+		}
+		if ce.Retryable != tt.retryable {
+			t.Errorf("%s: AsCheckError(%v).Retryable: want %v, got %v", tt.name, tt.err, tt.retryable, ce.Retryable)
+		}
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	cause := errors.New("denied")
+	err := errors.Wrap(NewCheckError(CategoryAuth, false, cause).WithField("bucket", "kubernary"), "s3 check failed")
+	if err.Error() != "s3 check failed: denied" {
+		t.Errorf("err.Error(): want %q, got %q", "s3 check failed: denied", err.Error())
+	}
+	if errors.Cause(err) != cause {
+		t.Errorf("errors.Cause(err): want %v, got %v", cause, errors.Cause(err))
+	}
+	ce, ok := AsCheckError(err)
+	if !ok {
+		t.Fatalf("AsCheckError(%v): want CheckError", err)
+	}
+	if ce.Fields["bucket"] != "kubernary" {
+		t.Errorf("ce.Fields[bucket]: want kubernary, got %v", ce.Fields["bucket"])
+	}
+}
@@ -0,0 +1,121 @@
+package kubernary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// subscriberBuffer is the number of results buffered for each subscriber.
+// Results are dropped for subscribers that fall further behind.
+const subscriberBuffer = 64
+
+// A Broadcaster is a Recorder that sends each result to all subscribers.
+type Broadcaster struct {
+	m    sync.Mutex
+	subs map[chan *Result]bool
+}
+
+// NewBroadcaster returns a Broadcaster with no subscribers.
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subs: map[chan *Result]bool{}}
+}
+
+// Record sends the supplied result to all subscribers, without blocking.
+func (b *Broadcaster) Record(r *Result) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	for s := range b.subs {
+		select {
+		case s <- r:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel upon which results will be sent until it is
+// passed to Unsubscribe.
+func (b *Broadcaster) Subscribe() chan *Result {
+	s := make(chan *Result, subscriberBuffer)
+	b.m.Lock()
+	b.subs[s] = true
+	b.m.Unlock()
+	return s
+}
+
+// Unsubscribe stops sending results to the supplied channel.
+func (b *Broadcaster) Unsubscribe(s chan *Result) {
+	b.m.Lock()
+	delete(b.subs, s)
+	b.m.Unlock()
+}
+
+type event struct {
+	Name      string        `json:"name"`
+	OK        bool          `json:"ok"`
+	Error     string        `json:"error"`
+	Duration  time.Duration `json:"duration"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+func sendEvent(w http.ResponseWriter, r *Result) error {
+	ev := &event{Name: r.Name, OK: r.Err == nil, Duration: r.Duration, Timestamp: r.Time}
+	if r.Err != nil {
+		ev.Error = r.Err.Error()
+	}
+	j, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: result\ndata: %s\n\n", j)
+	return err
+}
+
+// EventsHandler returns an HTTP handler that streams the results broadcast by
+// the supplied Broadcaster as Server-Sent Events. Results may be filtered by
+// passing one or more check query parameters, e.g. ?check=s3&check=sts. A
+// comment is sent every heartbeat interval to keep idle connections open.
+func EventsHandler(b *Broadcaster, heartbeat time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		checks := map[string]bool{}
+		for _, name := range r.URL.Query()["check"] {
+			checks[name] = true
+		}
+
+		s := b.Subscribe()
+		defer b.Unsubscribe(s)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		f.Flush()
+
+		t := time.NewTicker(heartbeat)
+		defer t.Stop()
+		for {
+			select {
+			case result := <-s:
+				if len(checks) > 0 && !checks[result.Name] {
+					continue
+				}
+				if err := sendEvent(w, result); err != nil {
+					return
+				}
+			case <-t.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case <-r.Context().Done():
+				return
+			}
+			f.Flush()
+		}
+	}
+}
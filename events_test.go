@@ -0,0 +1,72 @@
+package kubernary
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func (b *Broadcaster) subscribers() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return len(b.subs)
+}
+
+func TestEventsHandler(t *testing.T) {
+	b := NewBroadcaster()
+	srv := httptest.NewServer(EventsHandler(b, 10*time.Millisecond))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest("GET", srv.URL+"/events?check=s3", nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest(): %v", err)
+	}
+	rsp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("http.DefaultClient.Do(): %v", err)
+	}
+	defer rsp.Body.Close()
+	if ct := rsp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("rsp.Header.Get(Content-Type): want text/event-stream, got %s", ct)
+	}
+
+	b.Record(&Result{Name: "sts", Time: time.Now()})
+	b.Record(&Result{Name: "s3", Err: errors.New("boom"), Time: time.Now(), Duration: time.Second})
+
+	heartbeat := false
+	ev := &event{}
+	scanner := bufio.NewScanner(rsp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == ": heartbeat" {
+			heartbeat = true
+		}
+		if strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev); err != nil {
+				t.Fatalf("json.Unmarshal(%s): %v", line, err)
+			}
+		}
+		if heartbeat && ev.Name != "" {
+			break
+		}
+	}
+	if ev.Name != "s3" || ev.OK || ev.Error != "boom" || ev.Duration != time.Second {
+		t.Errorf("event: want failed s3 event, got %+v", ev)
+	}
+
+	cancel()
+	for i := 0; i < 100 && b.subscribers() > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if b.subscribers() != 0 {
+		t.Errorf("b.subscribers(): want 0 after disconnect, got %d", b.subscribers())
+	}
+}
@@ -0,0 +1,127 @@
+package kubernary
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Formats in which check results may be returned.
+const (
+	FormatJSON       string = "json"
+	FormatText       string = "text"
+	FormatPrometheus string = "prometheus"
+)
+
+const (
+	contentTypeJSON       string = "application/json; charset=utf-8"
+	contentTypeText       string = "text/plain; charset=utf-8"
+	contentTypePrometheus string = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+// negotiate returns the format requested by the supplied request's format
+// query parameter or, failing that, its Accept header. JSON is returned when no
+// supported format is requested.
+func negotiate(r *http.Request) string {
+	switch f := r.URL.Query().Get("format"); f {
+	case FormatJSON, FormatText, FormatPrometheus:
+		return f
+	}
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt := strings.ToLower(strings.TrimSpace(strings.SplitN(a, ";", 2)[0]))
+		switch {
+		case mt == "application/json", mt == mediaTypeJSONV2:
+			return FormatJSON
+		case mt == "application/openmetrics-text", mt == "text/plain" && strings.Contains(a, "version=0.0.4"):
+			return FormatPrometheus
+		case mt == "text/plain":
+			return FormatText
+		}
+	}
+	return FormatJSON
+}
+
+func sortedNames(errs map[string]error) []string {
+	names := make([]string, 0, len(errs))
+	for name := range errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sendTextCheckResults writes check results in the style of the Kubernetes API
+// server's verbose /readyz endpoint.
+func sendTextCheckResults(w http.ResponseWriter, errs map[string]error) error {
+	b := &bytes.Buffer{}
+	for _, name := range sortedNames(errs) {
+		err := errs[name]
+		switch {
+		case err == nil:
+			fmt.Fprintf(b, "[+]%s ok\n", name)
+		case timedOut(err):
+			fmt.Fprintf(b, "[-]%s timed out: %s\n", name, strings.Replace(err.Error(), "\n", " ", -1))
+		default:
+			fmt.Fprintf(b, "[-]%s failed: %s\n", name, strings.Replace(err.Error(), "\n", " ", -1))
+		}
+	}
+	switch code := statusCodeOf(errs); code {
+	case http.StatusOK:
+		b.WriteString("kubernary check passed\n")
+	case http.StatusGatewayTimeout:
+		w.WriteHeader(code)
+		b.WriteString("kubernary check timed out\n")
+	default:
+		w.WriteHeader(code)
+		b.WriteString("kubernary check failed\n")
+	}
+	_, err := b.WriteTo(w)
+	return errors.Wrap(err, "cannot write check statuses")
+}
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func prometheusLabels(name string, n *Node) string {
+	l := []string{fmt.Sprintf(`check="%s"`, escapeLabel(name))}
+	if n != nil {
+		labels := n.Labels()
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			l = append(l, fmt.Sprintf(`%s="%s"`, k, escapeLabel(labels[k])))
+		}
+	}
+	return "{" + strings.Join(l, ",") + "}"
+}
+
+// sendPrometheusCheckResults writes check results in the Prometheus text
+// exposition format. It always responds 200 OK, so that scrapes of failing
+// checks succeed.
+func sendPrometheusCheckResults(w http.ResponseWriter, cfgs []*CheckConfig, errs map[string]error) error {
+	nodes := map[string]*Node{}
+	for _, cfg := range cfgs {
+		nodes[cfg.Checker.Name()] = cfg.Node
+	}
+	b := &bytes.Buffer{}
+	b.WriteString("# HELP kubernary_check_up Whether the check passed.\n")
+	b.WriteString("# TYPE kubernary_check_up gauge\n")
+	for _, name := range sortedNames(errs) {
+		up := 1
+		if errs[name] != nil {
+			up = 0
+		}
+		fmt.Fprintf(b, "kubernary_check_up%s %d\n", prometheusLabels(name, nodes[name]), up)
+	}
+	_, err := b.WriteTo(w)
+	return errors.Wrap(err, "cannot write check statuses")
+}
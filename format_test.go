@@ -0,0 +1,81 @@
+package kubernary
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var negotiateTests = []struct {
+	name   string
+	url    string
+	accept string
+	want   string
+}{
+	{name: "Default", url: "/health", want: FormatJSON},
+	{name: "UnknownFormat", url: "/health?format=xml", want: FormatJSON},
+	{name: "QueryText", url: "/health?format=text", accept: "application/json", want: FormatText},
+	{name: "QueryPrometheus", url: "/health?format=prometheus", want: FormatPrometheus},
+	{name: "AcceptJSON", url: "/health", accept: "application/json", want: FormatJSON},
+	{name: "AcceptText", url: "/health", accept: "text/plain", want: FormatText},
+	{name: "AcceptPrometheus", url: "/health", accept: "text/plain;version=0.0.4;q=0.3,*/*;q=0.1", want: FormatPrometheus},
+	{name: "AcceptOpenMetrics", url: "/health", accept: "application/openmetrics-text; version=1.0.0", want: FormatPrometheus},
+	{name: "AcceptFirstSupported", url: "/health", accept: "text/html, text/plain, application/json", want: FormatText},
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tt := range negotiateTests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := negotiate(r); got != tt.want {
+			t.Errorf("%s: negotiate(): want %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+var formatTests = []struct {
+	format     string
+	wantStatus int
+	want       []string
+}{
+	{
+		format:     FormatText,
+		wantStatus: http.StatusServiceUnavailable,
+		want:       []string{"[+]pass ok\n", "[-]fail failed: kaboom\n", "kubernary check failed\n"},
+	},
+	{
+		format:     FormatPrometheus,
+		wantStatus: http.StatusOK,
+		want: []string{
+			"# TYPE kubernary_check_up gauge\n",
+			`kubernary_check_up{check="fail",node="node-\"a\""} 0` + "\n",
+			`kubernary_check_up{check="pass",node="node-\"a\""} 1` + "\n",
+		},
+	},
+}
+
+func TestChecksHandlerFormats(t *testing.T) {
+	n := &Node{Name: `node-"a"`}
+	cfgs := []*CheckConfig{
+		{Checker: &predictableChecker{name: "pass"}, Timeout: time.Second, Node: n},
+		{Checker: &predictableChecker{name: "fail", err: errors.New("kaboom")}, Timeout: time.Second, Node: n},
+	}
+	for _, tt := range formatTests {
+		w := httptest.NewRecorder()
+		ChecksHandler(cfgs)(w, httptest.NewRequest("GET", "/health?format="+tt.format, nil))
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: w.Code: want %v, got %v", tt.format, tt.wantStatus, w.Code)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Errorf("%s: w.Body: want %q, got:\n%s", tt.format, want, w.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+// Package grpchealth serves the results of kubernary checks via the gRPC
+// Health Checking Protocol.
+package grpchealth
+
+import (
+	"sync"
+
+	"github.com/negz/kubernary"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Overall is the gRPC health service name that reflects the results of all
+// checks. It is serving only when every check's most recent run passed.
+const Overall string = ""
+
+// A Recorder sets the serving status of a gRPC health service named after each
+// check to the result of its most recent run.
+type Recorder struct {
+	s      *health.Server
+	names  []string
+	m      sync.Mutex
+	passed map[string]bool
+}
+
+// NewRecorder returns a Recorder that sets the serving status of the supplied
+// gRPC health server. The status of each named check is UNKNOWN until it has
+// run. The status of the Overall service is NOT_SERVING as soon as any check
+// fails, but UNKNOWN until every check has run.
+func NewRecorder(s *health.Server, names ...string) *Recorder {
+	r := &Recorder{s: s, names: names, passed: map[string]bool{}}
+	s.SetServingStatus(Overall, healthpb.HealthCheckResponse_UNKNOWN)
+	for _, name := range names {
+		s.SetServingStatus(name, healthpb.HealthCheckResponse_UNKNOWN)
+	}
+	return r
+}
+
+func status(ok bool) healthpb.HealthCheckResponse_ServingStatus {
+	if ok {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
+
+// Record sets the serving status of the gRPC health service named after the
+// supplied result's check, and of the Overall service. Watchers of either
+// service are notified when its status changes.
+func (r *Recorder) Record(result *kubernary.Result) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.passed[result.Name] = result.Err == nil
+	r.s.SetServingStatus(result.Name, status(result.Err == nil))
+
+	for _, ok := range r.passed {
+		if !ok {
+			r.s.SetServingStatus(Overall, healthpb.HealthCheckResponse_NOT_SERVING)
+			return
+		}
+	}
+	for _, name := range r.names {
+		if _, ok := r.passed[name]; !ok {
+			r.s.SetServingStatus(Overall, healthpb.HealthCheckResponse_UNKNOWN)
+			return
+		}
+	}
+	r.s.SetServingStatus(Overall, healthpb.HealthCheckResponse_SERVING)
+}
@@ -0,0 +1,131 @@
+package grpchealth
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var recorderTests = []struct {
+	name    string
+	results []*kubernary.Result
+	want    map[string]healthpb.HealthCheckResponse_ServingStatus
+}{
+	{
+		name: "NoResults",
+		want: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			Overall: healthpb.HealthCheckResponse_UNKNOWN,
+			"s3":    healthpb.HealthCheckResponse_UNKNOWN,
+			"sts":   healthpb.HealthCheckResponse_UNKNOWN,
+		},
+	},
+	{
+		name:    "SomeResults",
+		results: []*kubernary.Result{{Name: "s3"}},
+		want: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			Overall: healthpb.HealthCheckResponse_UNKNOWN,
+			"s3":    healthpb.HealthCheckResponse_SERVING,
+			"sts":   healthpb.HealthCheckResponse_UNKNOWN,
+		},
+	},
+	{
+		name:    "AllPassing",
+		results: []*kubernary.Result{{Name: "s3"}, {Name: "sts"}},
+		want: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			Overall: healthpb.HealthCheckResponse_SERVING,
+			"s3":    healthpb.HealthCheckResponse_SERVING,
+			"sts":   healthpb.HealthCheckResponse_SERVING,
+		},
+	},
+	{
+		name:    "OneFailing",
+		results: []*kubernary.Result{{Name: "s3", Err: errors.New("boom")}},
+		want: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			Overall: healthpb.HealthCheckResponse_NOT_SERVING,
+			"s3":    healthpb.HealthCheckResponse_NOT_SERVING,
+			"sts":   healthpb.HealthCheckResponse_UNKNOWN,
+		},
+	},
+	{
+		name:    "Recovered",
+		results: []*kubernary.Result{{Name: "s3", Err: errors.New("boom")}, {Name: "sts"}, {Name: "s3"}},
+		want: map[string]healthpb.HealthCheckResponse_ServingStatus{
+			Overall: healthpb.HealthCheckResponse_SERVING,
+			"s3":    healthpb.HealthCheckResponse_SERVING,
+			"sts":   healthpb.HealthCheckResponse_SERVING,
+		},
+	},
+}
+
+func TestRecorder(t *testing.T) {
+	for _, tt := range recorderTests {
+		s := health.NewServer()
+		r := NewRecorder(s, "s3", "sts")
+		for _, result := range tt.results {
+			r.Record(result)
+		}
+		for service, want := range tt.want {
+			rsp, err := s.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Errorf("%s: s.Check(%q): %v", tt.name, service, err)
+				continue
+			}
+			if rsp.GetStatus() != want {
+				t.Errorf("%s: s.Check(%q): want %v, got %v", tt.name, service, want, rsp.GetStatus())
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := health.NewServer()
+	r := NewRecorder(s, "s3")
+
+	l := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, s)
+	go gs.Serve(l) // nolint: errcheck
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient(): %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	w, err := healthpb.NewHealthClient(conn).Watch(ctx, &healthpb.HealthCheckRequest{Service: "s3"})
+	if err != nil {
+		t.Fatalf("Watch(%q): %v", "s3", err)
+	}
+
+	recv := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		rsp, err := w.Recv()
+		if err != nil {
+			t.Fatalf("w.Recv(): %v", err)
+		}
+		if rsp.GetStatus() != want {
+			t.Errorf("w.Recv(): want %v, got %v", want, rsp.GetStatus())
+		}
+	}
+
+	recv(healthpb.HealthCheckResponse_UNKNOWN)
+	r.Record(&kubernary.Result{Name: "s3"})
+	recv(healthpb.HealthCheckResponse_SERVING)
+	r.Record(&kubernary.Result{Name: "s3", Err: errors.New("boom")})
+	recv(healthpb.HealthCheckResponse_NOT_SERVING)
+}
@@ -0,0 +1,63 @@
+package kubernary
+
+import (
+	"sync"
+	"time"
+)
+
+// A History is a Recorder that remembers the most recent results of each
+// check.
+type History struct {
+	size    int
+	m       sync.RWMutex
+	results map[string][]*Result
+	success map[string]time.Time
+}
+
+// NewHistory returns a History that remembers up to size results per check.
+func NewHistory(size int) *History {
+	return &History{size: size, results: map[string][]*Result{}, success: map[string]time.Time{}}
+}
+
+// Record remembers the supplied result, forgetting the oldest result of its
+// check if necessary.
+func (h *History) Record(r *Result) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	rs := append(h.results[r.Name], r)
+	if len(rs) > h.size {
+		rs = rs[len(rs)-h.size:]
+	}
+	h.results[r.Name] = rs
+	if r.Err == nil {
+		h.success[r.Name] = r.Time
+	}
+}
+
+// Results returns the remembered results of the named check, oldest first.
+func (h *History) Results(name string) []*Result {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	return append([]*Result{}, h.results[name]...)
+}
+
+// Latest returns the most recent result of the named check, or nil if the
+// check has not yet run.
+func (h *History) Latest(name string) *Result {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	rs := h.results[name]
+	if len(rs) == 0 {
+		return nil
+	}
+	return rs[len(rs)-1]
+}
+
+// LastSuccess returns the time the named check last passed, even if that
+// result has since been forgotten. The zero time is returned if the check
+// has never passed.
+func (h *History) LastSuccess(name string) time.Time {
+	h.m.RLock()
+	defer h.m.RUnlock()
+	return h.success[name]
+}
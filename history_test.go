@@ -0,0 +1,38 @@
+package kubernary
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(2)
+	if h.Latest("s3") != nil {
+		t.Errorf("h.Latest(s3): want nil before any results")
+	}
+
+	passed := time.Now()
+	h.Record(&Result{Name: "s3", Time: passed})
+	h.Record(&Result{Name: "s3", Err: errors.New("boom"), Time: passed.Add(time.Second)})
+	h.Record(&Result{Name: "s3", Err: errors.New("bang"), Time: passed.Add(2 * time.Second)})
+	h.Record(&Result{Name: "sts", Time: passed})
+
+	rs := h.Results("s3")
+	if len(rs) != 2 {
+		t.Fatalf("h.Results(s3): want 2 results, got %d", len(rs))
+	}
+	if rs[0].Err.Error() != "boom" || rs[1].Err.Error() != "bang" {
+		t.Errorf("h.Results(s3): want [boom bang], got [%v %v]", rs[0].Err, rs[1].Err)
+	}
+	if h.Latest("s3") != rs[1] {
+		t.Errorf("h.Latest(s3): want %v, got %v", rs[1], h.Latest("s3"))
+	}
+	if !h.LastSuccess("s3").Equal(passed) {
+		t.Errorf("h.LastSuccess(s3): want %v, got %v", passed, h.LastSuccess("s3"))
+	}
+	if len(h.Results("sts")) != 1 {
+		t.Errorf("h.Results(sts): want 1 result, got %d", len(h.Results("sts")))
+	}
+}
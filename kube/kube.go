@@ -0,0 +1,35 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// InClusterClient returns a Kubernetes client authenticated as the service
+// account kubernary runs as.
+func InClusterClient() (kubernetes.Interface, error) {
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot load in-cluster Kubernetes config")
+	}
+	c, err := kubernetes.NewForConfig(cfg)
+	return c, errors.Wrap(err, "cannot create Kubernetes client")
+}
+
+// Zone returns the availability zone of the supplied node, per its topology
+// labels. An empty string is returned if the node has no zone label.
+func Zone(ctx context.Context, k kubernetes.Interface, node string) (string, error) {
+	n, err := k.CoreV1().Nodes().Get(ctx, node, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get node %s", node)
+	}
+	if z, ok := n.GetLabels()[corev1.LabelTopologyZone]; ok {
+		return z, nil
+	}
+	return n.GetLabels()[corev1.LabelFailureDomainBetaZone], nil
+}
@@ -0,0 +1,52 @@
+package kube
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Unknown is used in place of a Peer's node or zone when it is not known.
+const Unknown string = "unknown"
+
+// A Peer is a kubernary instance.
+type Peer struct {
+	Pod     string `json:"pod"`
+	Node    string `json:"node"`
+	Zone    string `json:"zone"`
+	Address string `json:"address"`
+}
+
+// Peers returns every ready kubernary instance selected by the supplied
+// headless Service, as recorded by its EndpointSlices.
+func Peers(ctx context.Context, k kubernetes.Interface, namespace, service string) ([]Peer, error) {
+	sel := discoveryv1.LabelServiceName + "=" + service
+	slices, err := k.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{LabelSelector: sel})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list EndpointSlices")
+	}
+
+	peers := []Peer{}
+	for _, s := range slices.Items {
+		for _, e := range s.Endpoints {
+			if e.Conditions.Ready != nil && !*e.Conditions.Ready || len(e.Addresses) == 0 {
+				continue
+			}
+			p := Peer{Node: Unknown, Zone: Unknown, Address: e.Addresses[0]}
+			if e.NodeName != nil {
+				p.Node = *e.NodeName
+			}
+			if e.Zone != nil {
+				p.Zone = *e.Zone
+			}
+			if e.TargetRef != nil {
+				p.Pod = e.TargetRef.Name
+			}
+			peers = append(peers, p)
+		}
+	}
+	return peers, nil
+}
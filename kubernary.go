@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -23,26 +23,168 @@ type Checker interface {
 	Name() string
 }
 
+// A ContextChecker is a Checker that accepts a context. The context is done
+// when kubernary gives up on the check, for example because it timed out, and
+// the check should return promptly once it is. It carries the span tracing the
+// check's run.
+type ContextChecker interface {
+	Checker
+	CheckContext(ctx context.Context) error
+}
+
+// check runs the supplied Checker, passing it the supplied context if it
+// accepts one.
+func check(ctx context.Context, c Checker) error {
+	if cc, ok := c.(ContextChecker); ok {
+		return cc.CheckContext(ctx)
+	}
+	return c.Check()
+}
+
+// A HandlerChecker is a Checker that serves details of its most recent run via
+// HTTP.
+type HandlerChecker interface {
+	Checker
+	Handler() http.HandlerFunc
+}
+
 // A CheckConfig specified how a check should be run.
 type CheckConfig struct {
 	Checker  Checker
 	Interval time.Duration
 	Timeout  time.Duration
+
+	// BackgroundOnly checks are too slow or disruptive to run each time the
+	// health handlers are called. They are only run every interval.
+	BackgroundOnly bool
+
+	// Node describes where the check runs. It is included in check results.
+	Node *Node
+}
+
+// A Node describes where kubernary is running.
+type Node struct {
+	Name      string `json:"name,omitempty"`
+	Zone      string `json:"zone,omitempty"`
+	Pod       string `json:"pod,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// NodeFromEnv returns the Node described by the KUBERNARY_NODE_NAME,
+// KUBERNARY_NODE_ZONE, KUBERNARY_POD_NAME, and KUBERNARY_POD_NAMESPACE
+// environment variables, typically set via the downward API. The pod name
+// defaults to the hostname.
+func NodeFromEnv() *Node {
+	hostname, _ := os.Hostname() // nolint: gas
+	node := CheckConfigFromEnv("node", map[string]string{"NAME": "", "ZONE": ""})
+	pod := CheckConfigFromEnv("pod", map[string]string{"NAME": hostname, "NAMESPACE": ""})
+	return &Node{Name: node["NAME"], Zone: node["ZONE"], Pod: pod["NAME"], Namespace: pod["NAMESPACE"]}
+}
+
+// Labels returns the Node's known attributes, suitable for use as log fields
+// or metric tags.
+func (n *Node) Labels() map[string]string {
+	l := map[string]string{}
+	for k, v := range map[string]string{"node": n.Name, "zone": n.Zone, "pod": n.Pod, "namespace": n.Namespace} {
+		if v != "" {
+			l[k] = v
+		}
+	}
+	return l
+}
+
+// A Result is the outcome of running a check.
+type Result struct {
+	Name     string
+	Err      error
+	Time     time.Time
+	Duration time.Duration
+}
+
+// A Recorder records the results of checks run in the background.
+type Recorder interface {
+	Record(r *Result)
+}
+
+// run runs the supplied check and passes its result to the supplied recorders,
+// unless the supplied context is done first. It returns once the check does,
+// even if the check is given up on.
+func run(ctx context.Context, cfg *CheckConfig, rs []Recorder) {
+	r, returned := runOne(ctx, cfg)
+	if ctx.Err() == nil {
+		for _, rec := range rs {
+			rec.Record(r)
+		}
+	}
+	<-returned
+}
+
+// runOne runs the supplied check, giving up once its timeout elapses or the
+// supplied context is done. A check that is given up on continues to run in
+// the background until it returns, but its result is discarded. The returned
+// channel is closed when the check returns, which may be after runOne does.
+// Each run is traced as an OpenTelemetry span.
+func runOne(ctx context.Context, cfg *CheckConfig) (*Result, <-chan struct{}) {
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	ctx, span := startSpan(ctx, cfg)
+	started := time.Now()
+	done := make(chan error, 1)
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		done <- check(ctx, cfg.Checker)
+	}()
+
+	r := &Result{Name: cfg.Checker.Name(), Time: started}
+	select {
+	case r.Err = <-done:
+	case <-ctx.Done():
+		r.Err = errors.Wrap(ctx.Err(), "check timed out")
+		if ctx.Err() == context.DeadlineExceeded {
+			r.Err = NewCheckError(CategoryTimeout, true, r.Err)
+		}
+	}
+	r.Duration = time.Since(started)
+	endSpan(span, r)
+	return r, returned
 }
 
-// RunCheckForever causes a check to be run every configured interval, forever.
-func RunCheckForever(cfg *CheckConfig) context.CancelFunc {
+// RunCheckForever causes a check to be run immediately, then every configured
+// interval, forever. Each result is passed to the supplied recorders. A run is
+// skipped if the previous run, including one that timed out, has not yet
+// returned. Canceling the returned func cancels the context passed to any run
+// in flight.
+func RunCheckForever(cfg *CheckConfig, rs ...Recorder) context.CancelFunc {
 	t := time.NewTicker(cfg.Interval)
 	ctx, cancel := context.WithCancel(context.Background())
+	inflight := make(chan struct{}, 1)
+	start := func() {
+		select {
+		case inflight <- struct{}{}:
+		default:
+			// Don't pile up runs of a check that won't return.
+			return
+		}
+		go func() {
+			defer func() { <-inflight }()
+			run(ctx, cfg, rs)
+		}()
+	}
 	go func() {
+		// Don't leave consumers of results waiting an interval, which may be
+		// hours, for the first.
+		start()
 		for {
 			select {
 			case <-t.C:
-				// Disable linters concerned with unchecked errors.
-				// There is nothing for us to do with an error in this context.
 				// Emitting logs and metrics for failed checks is the
 				// responsibility of the checker.
-				go func() { cfg.Checker.Check() }() // nolint: gas,errcheck
+				start()
 			case <-ctx.Done():
 				t.Stop()
 				return
@@ -52,12 +194,12 @@ func RunCheckForever(cfg *CheckConfig) context.CancelFunc {
 	return cancel
 }
 
-// RunChecksForever causes a slice of checks to be run every configured
-// interval, forever.
-func RunChecksForever(cfgs []*CheckConfig) context.CancelFunc {
+// RunChecksForever causes a slice of checks to be run immediately, then every
+// configured interval, forever. Each result is passed to the supplied recorders.
+func RunChecksForever(cfgs []*CheckConfig, rs ...Recorder) context.CancelFunc {
 	cancels := make([]context.CancelFunc, 0, len(cfgs))
 	for _, cfg := range cfgs {
-		cancels = append(cancels, RunCheckForever(cfg))
+		cancels = append(cancels, RunCheckForever(cfg, rs...))
 	}
 	return func() {
 		for _, cancel := range cancels {
@@ -67,98 +209,155 @@ func RunChecksForever(cfgs []*CheckConfig) context.CancelFunc {
 }
 
 type e struct {
-	OK    bool   `json:"ok"`
-	Error string `json:"error"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Timeout bool   `json:"timeout,omitempty"`
+	Node    *Node  `json:"node,omitempty"`
 }
 
-func longestTimeoutOf(cfgs []*CheckConfig) time.Duration {
-	timeout := 0 * time.Nanosecond
-	for _, cfg := range cfgs {
-		if cfg.Timeout > timeout {
-			timeout = cfg.Timeout
+// timedOut returns true if the supplied error indicates a check timed out.
+func timedOut(err error) bool {
+	return err != nil && CategoryOf(err) == CategoryTimeout
+}
+
+// statusCodeOf returns the HTTP status code summarising the supplied check
+// results; 503 if any check failed, or 504 if checks only timed out.
+func statusCodeOf(errs map[string]error) int {
+	code := http.StatusOK
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case timedOut(err):
+			if code == http.StatusOK {
+				code = http.StatusGatewayTimeout
+			}
+		default:
+			return http.StatusServiceUnavailable
 		}
 	}
-	return timeout
+	return code
 }
 
 func runChecks(ctx context.Context, cfgs []*CheckConfig) map[string]error {
-	ctx, cancel := context.WithTimeout(ctx, longestTimeoutOf(cfgs))
-	defer cancel()
-
-	type result struct {
-		name string
-		err  error
+	errs := map[string]error{}
+	for name, r := range runCheckResults(ctx, cfgs) {
+		errs[name] = r.Err
 	}
-	wg := &sync.WaitGroup{}
-	rs := make(chan *result, len(cfgs))
+	return errs
+}
+
+func runCheckResults(ctx context.Context, cfgs []*CheckConfig) map[string]*Result {
+	rs := make(chan *Result, len(cfgs))
 	for _, cfg := range cfgs {
-		wg.Add(1)
-		go func(cfg *CheckConfig) { rs <- &result{cfg.Checker.Name(), cfg.Checker.Check()} }(cfg)
+		go func(cfg *CheckConfig) {
+			r, _ := runOne(ctx, cfg)
+			rs <- r
+		}(cfg)
 	}
-	allChecksDone := make(chan struct{}, 1)
-	go func() {
-		wg.Wait()
-		close(allChecksDone)
-	}()
-	results := map[string]error{}
-	for {
-		select {
-		case result := <-rs:
-			results[result.name] = result.err
-			wg.Done()
-		case <-ctx.Done():
-			for _, cfg := range cfgs {
-				if _, ok := results[cfg.Checker.Name()]; !ok {
-					results[cfg.Checker.Name()] = errors.Wrap(ctx.Err(), "check timed out")
-				}
-			}
-			return results
-		case <-allChecksDone:
-			return results
-		}
+	results := map[string]*Result{}
+	for range cfgs {
+		result := <-rs
+		results[result.Name] = result
 	}
+	return results
 }
 
-func sendJSONCheckResults(w http.ResponseWriter, errs map[string]error) error {
+func sendJSONCheckResults(w http.ResponseWriter, cfgs []*CheckConfig, errs map[string]error) error {
+	nodes := map[string]*Node{}
+	for _, cfg := range cfgs {
+		nodes[cfg.Checker.Name()] = cfg.Node
+	}
 	results := map[string]*e{}
 	for name, err := range errs {
 		if err != nil {
-			w.WriteHeader(http.StatusServiceUnavailable)
-			results[name] = &e{Error: err.Error()}
+			results[name] = &e{Error: err.Error(), Timeout: timedOut(err), Node: nodes[name]}
 			continue
 		}
-		results[name] = &e{OK: true}
+		results[name] = &e{OK: true, Node: nodes[name]}
 	}
 	j, err := json.Marshal(results)
 	if err != nil {
 		return errors.Wrap(err, "cannot marshal check statuses")
 	}
+	if code := statusCodeOf(errs); code != http.StatusOK {
+		w.WriteHeader(code)
+	}
 	_, err = w.Write(j)
 	return errors.Wrap(err, "cannot write healthy check status")
 }
 
+// onDemand returns the checks that may be run when a health handler is called.
+func onDemand(cfgs []*CheckConfig) []*CheckConfig {
+	od := make([]*CheckConfig, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		if !cfg.BackgroundOnly {
+			od = append(od, cfg)
+		}
+	}
+	return od
+}
+
+// A HandlerOption configures an HTTP handler.
+type HandlerOption func(*handler)
+
+type handler struct {
+	history *History
+}
+
+// WithHistory allows a handler to report results remembered by the supplied
+// History, such as when each check last passed.
+func WithHistory(h *History) HandlerOption {
+	return func(hd *handler) {
+		hd.history = h
+	}
+}
+
 // ChecksHandler returns an HTTP handler that runs the provided checks
-// concurrently and returns the results.
-func ChecksHandler(cfgs []*CheckConfig) http.HandlerFunc {
+// concurrently and returns the results. Background only checks are never run.
+// Results are returned as JSON, plain text, or Prometheus metrics per the
+// request's format query parameter or Accept header. Version 2 of the JSON
+// schema may be requested per schemaVersion; it alone reports background only
+// checks, using their most recent results.
+func ChecksHandler(cfgs []*CheckConfig, ho ...HandlerOption) http.HandlerFunc {
+	hd := &handler{}
+	for _, o := range ho {
+		o(hd)
+	}
+	od := onDemand(cfgs)
 	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		if err := sendJSONCheckResults(w, runChecks(r.Context(), cfgs)); err != nil {
+		var err error
+		switch format := negotiate(r); {
+		case format == FormatText:
+			w.Header().Set("Content-Type", contentTypeText)
+			err = sendTextCheckResults(w, runChecks(r.Context(), od))
+		case format == FormatPrometheus:
+			w.Header().Set("Content-Type", contentTypePrometheus)
+			err = sendPrometheusCheckResults(w, od, runChecks(r.Context(), od))
+		case schemaVersion(r) == 2:
+			w.Header().Set("Content-Type", contentTypeJSONV2)
+			results, cached := hd.results(r, cfgs)
+			err = sendJSONV2CheckResults(w, cfgs, hd.history, results, cached)
+		default:
+			w.Header().Set("Content-Type", contentTypeJSON)
+			err = sendJSONCheckResults(w, od, runChecks(r.Context(), od))
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		}
 	}
 }
 
-func sendJSONCheckResult(w http.ResponseWriter, err error) error {
+func sendJSONCheckResult(w http.ResponseWriter, n *Node, err error) error {
 	if err != nil {
-		j, jerr := json.Marshal(&e{Error: err.Error()})
+		j, jerr := json.Marshal(&e{Error: err.Error(), Timeout: timedOut(err), Node: n})
 		if jerr != nil {
 			return errors.Wrap(jerr, "cannot marshal unhealthy check status")
 		}
-		w.WriteHeader(http.StatusServiceUnavailable)
+		w.WriteHeader(statusCodeOf(map[string]error{"": err}))
 		_, werr := w.Write(j)
 		return errors.Wrap(werr, "cannot write unhealthy check status")
 	}
-	j, jerr := json.Marshal(&e{OK: true})
+	j, jerr := json.Marshal(&e{OK: true, Node: n})
 	if jerr != nil {
 		return errors.Wrap(jerr, "cannot marshal healthy check status")
 	}
@@ -167,14 +366,18 @@ func sendJSONCheckResult(w http.ResponseWriter, err error) error {
 }
 
 // CheckHandler returns an HTTP handler that runs the provided check and returns
-// the results.
+// the results. The handler responds 404 Not Found for background only checks.
 func CheckHandler(cfg *CheckConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.BackgroundOnly {
+			http.Error(w, fmt.Sprintf("check %s cannot be run on demand", cfg.Checker.Name()), http.StatusNotFound)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		cfgs := []*CheckConfig{cfg}
 		results := runChecks(r.Context(), cfgs)
 		for _, result := range results {
-			if err := sendJSONCheckResult(w, result); err != nil {
+			if err := sendJSONCheckResult(w, cfg.Node, result); err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 			}
 			return
@@ -182,6 +385,17 @@ func CheckHandler(cfg *CheckConfig) http.HandlerFunc {
 	}
 }
 
+// PingHandler returns an HTTP handler that reports kubernary is up without
+// running any checks. Peer kubernary instances use it to test connectivity.
+func PingHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if err := sendJSONCheckResult(w, nil, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
 // ShutdownHandler shuts down kubernary when called.
 func ShutdownHandler(cancel context.CancelFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, _ *http.Request) {
@@ -206,3 +420,40 @@ func CheckConfigFromEnv(name string, config map[string]string) map[string]string
 	}
 	return populated
 }
+
+// SplitConfigValue splits a comma separated check configuration value, such as
+// one read by CheckConfigFromEnv, ignoring empty values.
+func SplitConfigValue(v string) []string {
+	s := []string{}
+	for _, e := range strings.Split(v, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			s = append(s, e)
+		}
+	}
+	return s
+}
+
+// JSONValueAt returns the value at the supplied dot separated path of v, which
+// must have been unmarshalled from JSON. Each element of the path is an object
+// key or an array index, e.g. items.0.status.
+func JSONValueAt(v interface{}, path string) (interface{}, error) {
+	for _, k := range strings.Split(path, ".") {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			e, ok := t[k]
+			if !ok {
+				return nil, errors.Errorf("key %s not found", k)
+			}
+			v = e
+		case []interface{}:
+			i, err := strconv.Atoi(k)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, errors.Errorf("index %s not found", k)
+			}
+			v = t[i]
+		default:
+			return nil, errors.Errorf("cannot index %s into %T", k, v)
+		}
+	}
+	return v, nil
+}
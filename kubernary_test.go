@@ -1,9 +1,12 @@
 package kubernary
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -45,6 +48,23 @@ func (c *predictableChecker) runs() int {
 	return c.r
 }
 
+type predictableRecorder struct {
+	m       sync.Mutex
+	results []*Result
+}
+
+func (r *predictableRecorder) Record(result *Result) {
+	r.m.Lock()
+	r.results = append(r.results, result)
+	r.m.Unlock()
+}
+
+func (r *predictableRecorder) recorded() []*Result {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.results
+}
+
 var checkerTests = []struct {
 	cfgs              []*CheckConfig
 	cancelImmediately bool
@@ -67,7 +87,7 @@ var checkerTests = []struct {
 	{
 		cfgs: []*CheckConfig{
 			&CheckConfig{
-				// Sleep for longer than the longest timeout of this config check (i.e. 200ms).
+				// Sleep for longer than the timeout of this check (i.e. 100ms).
 				Checker:  &predictableChecker{name: testWillTimeout, do: func() { time.Sleep(300 * time.Millisecond) }},
 				Interval: 100 * time.Millisecond,
 				Timeout:  100 * time.Millisecond,
@@ -122,12 +142,18 @@ func TestChecker(t *testing.T) {
 				time.Sleep(longestInterval + 20*time.Millisecond)
 			}
 			cancel()
+			if tt.cancelImmediately {
+				// Wait for the runs started when the checks were scheduled,
+				// including those that time out, to finish.
+				time.Sleep(350 * time.Millisecond)
+			}
 
 			for _, cfg := range tt.cfgs {
-				expectedRuns := 0
+				// Each check runs once when scheduled.
+				expectedRuns := 1
 				if longestInterval > 0*time.Nanosecond && cfg.Interval > 0*time.Nanosecond {
-					// Expected runs should be longest interval / interval
-					expectedRuns = int(longestInterval / cfg.Interval)
+					// Expected runs should be 1 + longest interval / interval
+					expectedRuns += int(longestInterval / cfg.Interval)
 					t.Logf("Expected runs for %s: %v (%s / %s)", cfg.Checker.Name(), expectedRuns, longestInterval, cfg.Interval)
 				}
 
@@ -146,7 +172,7 @@ func TestChecker(t *testing.T) {
 
 	t.Run("CheckHandlers", func(t *testing.T) {
 		for _, tt := range checkerTests {
-			checksWillFail := false
+			checksWillFail, checksWillTimeout := false, false
 			for _, cfg := range tt.cfgs {
 				p, ok := cfg.Checker.(*predictableChecker)
 				if !ok {
@@ -157,12 +183,16 @@ func TestChecker(t *testing.T) {
 					t.Logf("Config %s has failing checks.", cfg.Checker.Name())
 				}
 				if cfg.Checker.Name() == testWillTimeout {
-					checksWillFail = true
+					checksWillTimeout = true
 				}
 			}
 			w := httptest.NewRecorder()
 			ChecksHandler(tt.cfgs)(w, httptest.NewRequest("GET", "/", nil))
 			expectedStatus := http.StatusOK
+			if checksWillTimeout {
+				expectedStatus = http.StatusGatewayTimeout
+				t.Log("This check config set should time out.")
+			}
 			if checksWillFail {
 				expectedStatus = http.StatusServiceUnavailable
 				t.Log("This check config set should fail.")
@@ -186,17 +216,21 @@ func TestChecker(t *testing.T) {
 			if !ok {
 				t.Fatal("cfg.Checker: wanted predictableChecker")
 			}
-			checksWillFail := false
+			checksWillFail, checksWillTimeout := false, false
 			if p.err != nil {
 				checksWillFail = true
 				t.Logf("Config %s has failing checks.", cfg.Checker.Name())
 			}
 			if cfg.Checker.Name() == testWillTimeout {
-				checksWillFail = true
+				checksWillTimeout = true
 			}
 			w := httptest.NewRecorder()
 			CheckHandler(tt.cfgs[0])(w, httptest.NewRequest("GET", "/", nil))
 			expectedStatus := http.StatusOK
+			if checksWillTimeout {
+				expectedStatus = http.StatusGatewayTimeout
+				t.Log("This check config set should time out.")
+			}
 			if checksWillFail {
 				expectedStatus = http.StatusServiceUnavailable
 				t.Log("This check config set should fail.")
@@ -213,3 +247,256 @@ func TestChecker(t *testing.T) {
 		}
 	})
 }
+
+func TestBackgroundOnly(t *testing.T) {
+	bg := &predictableChecker{name: "background"}
+	cfgs := []*CheckConfig{
+		&CheckConfig{Checker: &predictableChecker{name: "ondemand"}, Interval: time.Minute, Timeout: time.Second},
+		&CheckConfig{Checker: bg, Interval: time.Minute, Timeout: time.Second, BackgroundOnly: true},
+	}
+
+	w := httptest.NewRecorder()
+	ChecksHandler(cfgs)(w, httptest.NewRequest("GET", "/", nil))
+	results := map[string]*e{}
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatalf("json.Unmarshal(%v): %v", w.Body, err)
+	}
+	if _, ok := results["ondemand"]; !ok {
+		t.Error("ChecksHandler(): want ondemand result, got none")
+	}
+	if _, ok := results["background"]; ok {
+		t.Error("ChecksHandler(): want no background result")
+	}
+
+	w = httptest.NewRecorder()
+	CheckHandler(cfgs[1])(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("CheckHandler(background) w.Code: want %v, got %v", http.StatusNotFound, w.Code)
+	}
+	if bg.runs() != 0 {
+		t.Errorf("bg.runs(): want 0, got %d", bg.runs())
+	}
+}
+
+var splitConfigValueTests = []struct {
+	name string
+	v    string
+	want []string
+}{
+	{name: "Empty", v: "", want: []string{}},
+	{name: "One", v: "a", want: []string{"a"}},
+	{name: "Many", v: "a, b,,c ", want: []string{"a", "b", "c"}},
+}
+
+func TestSplitConfigValue(t *testing.T) {
+	for _, tt := range splitConfigValueTests {
+		if got := SplitConfigValue(tt.v); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SplitConfigValue(%q): want %v, got %v", tt.name, tt.v, tt.want, got)
+		}
+	}
+}
+
+var jsonValueAtTests = []struct {
+	name    string
+	path    string
+	want    interface{}
+	wantErr bool
+}{
+	{name: "Key", path: "status.ok", want: true},
+	{name: "Index", path: "items.0.name", want: "kubernary"},
+	{name: "MissingKey", path: "status.nope", wantErr: true},
+	{name: "MissingIndex", path: "items.1.name", wantErr: true},
+	{name: "NotAnIndex", path: "items.first.name", wantErr: true},
+	{name: "Scalar", path: "status.ok.nope", wantErr: true},
+}
+
+func TestJSONValueAt(t *testing.T) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(`{"status": {"ok": true}, "items": [{"name": "kubernary"}]}`), &v); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	for _, tt := range jsonValueAtTests {
+		got, err := JSONValueAt(v, tt.path)
+		if err != nil {
+			if !tt.wantErr {
+				t.Errorf("%s: JSONValueAt(%s): %v", tt.name, tt.path, err)
+			}
+			continue
+		}
+		if tt.wantErr {
+			t.Errorf("%s: JSONValueAt(%s): want error, got %v", tt.name, tt.path, got)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: JSONValueAt(%s): want %v, got %v", tt.name, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestPingHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	PingHandler()(w, httptest.NewRequest("GET", "/ping", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code: want %v, got %v", http.StatusOK, w.Code)
+	}
+	result := &e{}
+	if err := json.Unmarshal(w.Body.Bytes(), result); err != nil {
+		t.Errorf("json.Unmarshal(%v, %v): %v", w.Body, result, err)
+	}
+	if !result.OK {
+		t.Errorf("result.OK: want true, got false")
+	}
+}
+
+func TestNodeFromEnv(t *testing.T) {
+	os.Setenv("KUBERNARY_NODE_NAME", "node-a")     // nolint: errcheck
+	os.Setenv("KUBERNARY_POD_NAMESPACE", "system") // nolint: errcheck
+	defer os.Unsetenv("KUBERNARY_NODE_NAME")       // nolint: errcheck
+	defer os.Unsetenv("KUBERNARY_POD_NAMESPACE")   // nolint: errcheck
+
+	n := NodeFromEnv()
+	hostname, _ := os.Hostname()
+	want := map[string]string{"node": "node-a", "pod": hostname, "namespace": "system"}
+	got := n.Labels()
+	if len(got) != len(want) {
+		t.Errorf("n.Labels(): want %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("n.Labels()[%s]: want %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	boom := errors.New("boom")
+	cfg := &CheckConfig{Checker: &predictableChecker{name: "fail", err: boom}, Interval: 10 * time.Millisecond}
+	r := &predictableRecorder{}
+	cancel := RunCheckForever(cfg, r)
+	time.Sleep(35 * time.Millisecond)
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	results := r.recorded()
+	if len(results) == 0 {
+		t.Fatal("r.recorded(): want results, got none")
+	}
+	for _, result := range results {
+		if result.Name != "fail" {
+			t.Errorf("result.Name: want fail, got %v", result.Name)
+		}
+		if result.Err != boom {
+			t.Errorf("result.Err: want %v, got %v", boom, result.Err)
+		}
+		if result.Time.IsZero() {
+			t.Error("result.Time: want non-zero time")
+		}
+	}
+}
+
+func TestRunCheckForeverRunsImmediately(t *testing.T) {
+	cfg := &CheckConfig{Checker: &predictableChecker{name: "pass"}, Interval: time.Hour, Timeout: time.Second}
+	r := &predictableRecorder{}
+	cancel := RunCheckForever(cfg, r)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if got := len(r.recorded()); got != 1 {
+		t.Errorf("r.recorded(): want 1 result, got %d", got)
+	}
+}
+
+func TestRunCheckTimeout(t *testing.T) {
+	cfg := &CheckConfig{
+		Checker:  &predictableChecker{name: testWillTimeout, do: func() { time.Sleep(100 * time.Millisecond) }},
+		Interval: time.Minute,
+		Timeout:  10 * time.Millisecond,
+	}
+	r := &predictableRecorder{}
+	run(context.Background(), cfg, []Recorder{r})
+
+	results := r.recorded()
+	if len(results) != 1 {
+		t.Fatalf("r.recorded(): want 1 result, got %d", len(results))
+	}
+	if !timedOut(results[0].Err) {
+		t.Errorf("timedOut(%v): want true, got false", results[0].Err)
+	}
+	if results[0].Duration >= 100*time.Millisecond {
+		t.Errorf("results[0].Duration: want < 100ms, got %s", results[0].Duration)
+	}
+}
+
+type predictableContextChecker struct {
+	predictableChecker
+}
+
+// CheckContext blocks until the supplied context is done.
+func (c *predictableContextChecker) CheckContext(ctx context.Context) error {
+	c.run()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRunOneContextChecker(t *testing.T) {
+	c := &predictableContextChecker{predictableChecker{name: testWillTimeout}}
+	r, returned := runOne(context.Background(), &CheckConfig{Checker: c, Interval: time.Minute, Timeout: 10 * time.Millisecond})
+	if !timedOut(r.Err) {
+		t.Errorf("timedOut(%v): want true, got false", r.Err)
+	}
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Error("c.CheckContext(): want return once its context is done")
+	}
+	if c.runs() != 1 {
+		t.Errorf("c.runs(): want 1, got %d", c.runs())
+	}
+}
+
+func TestRunCheckForeverSkipsInFlight(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	c := &predictableChecker{name: testWillTimeout, do: func() {
+		started <- struct{}{}
+		<-release
+	}}
+	r := &predictableRecorder{}
+	cancel := RunCheckForever(&CheckConfig{Checker: c, Interval: 10 * time.Millisecond, Timeout: 5 * time.Millisecond}, r)
+	time.Sleep(100 * time.Millisecond)
+
+	// The first run timed out, but has not returned.
+	if got := len(started); got != 1 {
+		t.Errorf("runs started: want 1, got %d", got)
+	}
+	if got := len(r.recorded()); got != 1 {
+		t.Errorf("r.recorded(): want 1 result, got %d", got)
+	}
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if got := len(started); got < 2 {
+		t.Errorf("runs started after release: want at least 2, got %d", got)
+	}
+}
+
+func TestStatusCodeOf(t *testing.T) {
+	timeout := NewCheckError(CategoryTimeout, true, errors.New("slow"))
+	cases := []struct {
+		name string
+		errs map[string]error
+		want int
+	}{
+		{name: "Passed", errs: map[string]error{"a": nil}, want: http.StatusOK},
+		{name: "TimedOut", errs: map[string]error{"a": nil, "b": timeout}, want: http.StatusGatewayTimeout},
+		{name: "Failed", errs: map[string]error{"a": timeout, "b": errors.New("boom")}, want: http.StatusServiceUnavailable},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusCodeOf(tt.errs); got != tt.want {
+				t.Errorf("statusCodeOf(%v): want %d, got %d", tt.errs, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package kubernary
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Version is the version of kubernary. It is set at build time.
+var Version = "unknown"
+
+// APIVersionV2 identifies version 2 of the JSON check result schema.
+const APIVersionV2 string = "kubernary/v2"
+
+const (
+	mediaTypeJSONV2   string = "application/vnd.kubernary.v2+json"
+	contentTypeJSONV2 string = mediaTypeJSONV2 + "; charset=utf-8"
+)
+
+// Check statuses reported by version 2 of the JSON check result schema.
+const (
+	// StatusOK indicates a check passed.
+	StatusOK string = "ok"
+
+	// StatusFailed indicates a check failed.
+	StatusFailed string = "failed"
+
+	// StatusTimeout indicates a check did not complete within its timeout.
+	StatusTimeout string = "timeout"
+
+	// StatusSkipped indicates a check has not yet run in the background.
+	StatusSkipped string = "skipped"
+
+	// StatusStale indicates a check has not completed in the background for
+	// over two intervals.
+	StatusStale string = "stale"
+)
+
+type errorV2 struct {
+	Message   string            `json:"message"`
+	Cause     string            `json:"cause"`
+	Category  Category          `json:"category"`
+	Retryable bool              `json:"retryable"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+type checkV2 struct {
+	Status          string     `json:"status"`
+	CheckedAt       *time.Time `json:"checkedAt"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	LastSuccess     *time.Time `json:"lastSuccess"`
+	Error           *errorV2   `json:"error,omitempty"`
+}
+
+type resultsV2 struct {
+	APIVersion       string              `json:"apiVersion"`
+	Status           string              `json:"status"`
+	GeneratedAt      time.Time           `json:"generatedAt"`
+	KubernaryVersion string              `json:"kubernaryVersion"`
+	Node             *Node               `json:"node,omitempty"`
+	Checks           map[string]*checkV2 `json:"checks"`
+}
+
+// schemaVersion returns the JSON schema version requested by the supplied
+// request's version query parameter or, failing that, its Accept header.
+// Version 1 is returned when no supported version is requested.
+func schemaVersion(r *http.Request) int {
+	if v, err := strconv.Atoi(r.URL.Query().Get("version")); err == nil && v == 2 {
+		return 2
+	}
+	for _, a := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.ToLower(strings.TrimSpace(strings.SplitN(a, ";", 2)[0])) == mediaTypeJSONV2 {
+			return 2
+		}
+	}
+	return 1
+}
+
+// results returns the results of the supplied checks. On demand checks are run
+// unless the cached query parameter is true and a History is available, in
+// which case the most recent result of each check run in the background is
+// returned. Background only checks are never run; their most recent results
+// are returned if a History is available. The returned bool indicates whether
+// the results of on demand checks were cached.
+func (hd *handler) results(r *http.Request, cfgs []*CheckConfig) (map[string]*Result, bool) {
+	cached, _ := strconv.ParseBool(r.URL.Query().Get("cached")) // nolint: gas
+	cached = cached && hd.history != nil
+	results := map[string]*Result{}
+	if !cached {
+		results = runCheckResults(r.Context(), onDemand(cfgs))
+	}
+	if hd.history == nil {
+		return results, false
+	}
+	for _, cfg := range cfgs {
+		if !cached && !cfg.BackgroundOnly {
+			continue
+		}
+		if result := hd.history.Latest(cfg.Checker.Name()); result != nil {
+			results[cfg.Checker.Name()] = result
+		}
+	}
+	return results, cached
+}
+
+// statusOf returns the status of the supplied result. Only cached results,
+// including every result of a background only check, may be stale.
+func statusOf(cfg *CheckConfig, r *Result, cached bool, now time.Time) string {
+	switch {
+	case r == nil:
+		return StatusSkipped
+	case cached && now.Sub(r.Time) > 2*cfg.Interval+cfg.Timeout:
+		return StatusStale
+	case r.Err == nil:
+		return StatusOK
+	case CategoryOf(r.Err) == CategoryTimeout:
+		return StatusTimeout
+	default:
+		return StatusFailed
+	}
+}
+
+func checkV2Of(cfg *CheckConfig, h *History, r *Result, cached bool, now time.Time) *checkV2 {
+	c := &checkV2{Status: statusOf(cfg, r, cached || cfg.BackgroundOnly, now)}
+	if h != nil {
+		if t := h.LastSuccess(cfg.Checker.Name()); !t.IsZero() {
+			c.LastSuccess = &t
+		}
+	}
+	if r == nil {
+		return c
+	}
+	c.CheckedAt = &r.Time
+	c.DurationSeconds = r.Duration.Seconds()
+	if r.Err == nil && (c.LastSuccess == nil || r.Time.After(*c.LastSuccess)) {
+		c.LastSuccess = &r.Time
+	}
+	if r.Err != nil {
+		c.Error = &errorV2{Message: r.Err.Error(), Cause: errors.Cause(r.Err).Error(), Category: CategoryOf(r.Err)}
+		if ce, ok := AsCheckError(r.Err); ok {
+			c.Error.Retryable = ce.Retryable
+			c.Error.Fields = ce.Fields
+		}
+	}
+	return c
+}
+
+func sendJSONV2CheckResults(w http.ResponseWriter, cfgs []*CheckConfig, h *History, results map[string]*Result, cached bool) error {
+	rs := &resultsV2{
+		APIVersion:       APIVersionV2,
+		Status:           StatusOK,
+		GeneratedAt:      time.Now(),
+		KubernaryVersion: Version,
+		Checks:           map[string]*checkV2{},
+	}
+	for _, cfg := range cfgs {
+		if rs.Node == nil {
+			rs.Node = cfg.Node
+		}
+		c := checkV2Of(cfg, h, results[cfg.Checker.Name()], cached, rs.GeneratedAt)
+		switch c.Status {
+		case StatusOK, StatusSkipped:
+			// A check that has not yet run has neither passed nor failed.
+		case StatusTimeout:
+			if rs.Status == StatusOK {
+				rs.Status = StatusTimeout
+			}
+		default:
+			rs.Status = StatusFailed
+		}
+		rs.Checks[cfg.Checker.Name()] = c
+	}
+
+	j, err := json.Marshal(rs)
+	if err != nil {
+		return errors.Wrap(err, "cannot marshal check statuses")
+	}
+	switch rs.Status {
+	case StatusOK:
+	case StatusTimeout:
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, err = w.Write(j)
+	return errors.Wrap(err, "cannot write check statuses")
+}
@@ -0,0 +1,137 @@
+package kubernary
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var schemaVersionTests = []struct {
+	name   string
+	url    string
+	accept string
+	want   int
+}{
+	{name: "Default", url: "/health", want: 1},
+	{name: "QueryV1", url: "/health?version=1", want: 1},
+	{name: "QueryV2", url: "/health?version=2", want: 2},
+	{name: "AcceptV2", url: "/health", accept: "application/vnd.kubernary.v2+json", want: 2},
+}
+
+func TestSchemaVersion(t *testing.T) {
+	for _, tt := range schemaVersionTests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		if got := schemaVersion(r); got != tt.want {
+			t.Errorf("%s: schemaVersion(): want %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func getV2(t *testing.T, h http.HandlerFunc, url string) (int, *resultsV2) {
+	w := httptest.NewRecorder()
+	h(w, httptest.NewRequest("GET", url, nil))
+	rs := &resultsV2{}
+	if err := json.Unmarshal(w.Body.Bytes(), rs); err != nil {
+		t.Fatalf("json.Unmarshal(%s): %v", w.Body, err)
+	}
+	if rs.APIVersion != APIVersionV2 {
+		t.Errorf("rs.APIVersion: want %s, got %s", APIVersionV2, rs.APIVersion)
+	}
+	return w.Code, rs
+}
+
+func TestChecksHandlerV2(t *testing.T) {
+	sleep := func() { time.Sleep(200 * time.Millisecond) }
+	cfgs := []*CheckConfig{
+		{Checker: &predictableChecker{name: "pass"}, Interval: time.Minute, Timeout: 100 * time.Millisecond},
+		{Checker: &predictableChecker{name: "fail", err: errors.New("kaboom")}, Interval: time.Minute, Timeout: 100 * time.Millisecond},
+		{Checker: &predictableChecker{name: "timeout", do: sleep}, Interval: time.Minute, Timeout: 50 * time.Millisecond},
+	}
+	passed := time.Now().Add(-3 * time.Minute)
+	hist := NewHistory(10)
+	hist.Record(&Result{Name: "pass", Time: time.Now()})
+	hist.Record(&Result{Name: "fail", Time: passed})
+	h := ChecksHandler(cfgs, WithHistory(hist))
+
+	t.Run("Live", func(t *testing.T) {
+		code, rs := getV2(t, h, "/health?version=2")
+		if code != http.StatusServiceUnavailable || rs.Status != StatusFailed {
+			t.Errorf("want %d %s, got %d %s", http.StatusServiceUnavailable, StatusFailed, code, rs.Status)
+		}
+		want := map[string]string{"pass": StatusOK, "fail": StatusFailed, "timeout": StatusTimeout}
+		for name, status := range want {
+			if rs.Checks[name].Status != status {
+				t.Errorf("rs.Checks[%s].Status: want %s, got %s", name, status, rs.Checks[name].Status)
+			}
+		}
+		if e := rs.Checks["fail"].Error; e == nil || e.Message != "kaboom" {
+			t.Errorf("rs.Checks[fail].Error: want kaboom, got %+v", e)
+		}
+		if ls := rs.Checks["fail"].LastSuccess; ls == nil || !ls.Equal(passed) {
+			t.Errorf("rs.Checks[fail].LastSuccess: want %v, got %v", passed, ls)
+		}
+		if rs.KubernaryVersion != Version {
+			t.Errorf("rs.KubernaryVersion: want %s, got %s", Version, rs.KubernaryVersion)
+		}
+	})
+
+	t.Run("Cached", func(t *testing.T) {
+		_, rs := getV2(t, h, "/health?version=2&cached=true")
+		want := map[string]string{"pass": StatusOK, "fail": StatusStale, "timeout": StatusSkipped}
+		for name, status := range want {
+			if rs.Checks[name].Status != status {
+				t.Errorf("rs.Checks[%s].Status: want %s, got %s", name, status, rs.Checks[name].Status)
+			}
+		}
+	})
+}
+
+func TestChecksHandlerV2Skipped(t *testing.T) {
+	cfgs := []*CheckConfig{
+		{Checker: &predictableChecker{name: "pass"}, Interval: time.Minute, Timeout: 100 * time.Millisecond},
+		{Checker: &predictableChecker{name: "notyet"}, Interval: time.Hour, Timeout: 100 * time.Millisecond},
+	}
+	hist := NewHistory(10)
+	hist.Record(&Result{Name: "pass", Time: time.Now()})
+
+	code, rs := getV2(t, ChecksHandler(cfgs, WithHistory(hist)), "/health?version=2&cached=true")
+	if code != http.StatusOK || rs.Status != StatusOK {
+		t.Errorf("want %d %s, got %d %s", http.StatusOK, StatusOK, code, rs.Status)
+	}
+	if rs.Checks["notyet"].Status != StatusSkipped {
+		t.Errorf("rs.Checks[notyet].Status: want %s, got %s", StatusSkipped, rs.Checks["notyet"].Status)
+	}
+}
+
+func TestChecksHandlerV2BackgroundOnly(t *testing.T) {
+	bg := &predictableChecker{name: "background"}
+	cfgs := []*CheckConfig{
+		{Checker: &predictableChecker{name: "pass"}, Interval: time.Minute, Timeout: 100 * time.Millisecond},
+		{Checker: bg, Interval: time.Minute, Timeout: 100 * time.Millisecond, BackgroundOnly: true},
+	}
+	hist := NewHistory(10)
+	hist.Record(&Result{Name: "background", Err: errors.New("kaboom"), Time: time.Now()})
+
+	code, rs := getV2(t, ChecksHandler(cfgs, WithHistory(hist)), "/health?version=2")
+	if code != http.StatusServiceUnavailable || rs.Status != StatusFailed {
+		t.Errorf("want %d %s, got %d %s", http.StatusServiceUnavailable, StatusFailed, code, rs.Status)
+	}
+	if rs.Checks["background"].Status != StatusFailed {
+		t.Errorf("rs.Checks[background].Status: want %s, got %s", StatusFailed, rs.Checks["background"].Status)
+	}
+	if bg.runs() != 0 {
+		t.Errorf("bg.runs(): want 0, got %d", bg.runs())
+	}
+
+	_, rs = getV2(t, ChecksHandler(cfgs), "/health?version=2")
+	if rs.Checks["background"].Status != StatusSkipped {
+		t.Errorf("rs.Checks[background].Status without history: want %s, got %s", StatusSkipped, rs.Checks["background"].Status)
+	}
+}
@@ -3,24 +3,20 @@
 set -e
 
 DIST="dist"
-VENDOR="vendor"
 
 export GOOS="linux"
 export GOARCH="amd64"
 
 [ -d "${DIST}" ] || mkdir -p "${DIST}"
-[ -d "${VENDOR}" ] && rm -rf "${VENDOR}"
 
-# Ideally we'd use a specific version of Glide.
-go get -u github.com/Masterminds/glide
+# Fetch the module versions pinned by go.mod and go.sum.
+go mod download
 
-# Create the vendor directory based on glide.lock
-glide install
+VERSION=$(git rev-parse --short HEAD)
 
 # Build the binary
-go build -o "${DIST}/kubernary" ./cmd/kubernary
+go build -ldflags "-X github.com/negz/kubernary.Version=${VERSION}" -o "${DIST}/kubernary" ./cmd/kubernary
 
 # Create the docker image
-VERSION=$(git rev-parse --short HEAD)
 docker build --tag "negz/kubernary:latest" .
 docker build --tag "negz/kubernary:${VERSION}" .
\ No newline at end of file
@@ -0,0 +1,44 @@
+package kubernary
+
+import (
+	"github.com/negz/kubernary/dogstatsd"
+
+	"github.com/cactus/go-statsd-client/statsd"
+)
+
+const (
+	metricResultSucceeded string = "result.succeeded"
+	metricResultFailed    string = "result.failed"
+	metricTimeout         string = "timeout"
+
+	tagCategory string = "category"
+)
+
+// A StatsRecorder is a Recorder that emits statsd metrics for each result.
+type StatsRecorder struct {
+	stats statsd.Statter
+}
+
+// NewStatsRecorder returns a Recorder that emits metrics to the supplied
+// statsd client.
+func NewStatsRecorder(s statsd.Statter) *StatsRecorder {
+	return &StatsRecorder{stats: s}
+}
+
+// Record counts the supplied result as <check>.result.succeeded, as
+// <check>.timeout for timeouts, or as <check>.result.failed.<category> for
+// other failures. The category is sent as a tag rather than as part of the
+// metric name when using a DogStatsD client.
+func (r *StatsRecorder) Record(result *Result) {
+	s := r.stats.NewSubStatter(result.Name)
+
+	// There is nothing for us to do with an error in this context.
+	switch {
+	case timedOut(result.Err):
+		s.Inc(metricTimeout, 1, 1.0) // nolint: gas,errcheck
+	case result.Err != nil:
+		dogstatsd.Inc(s, metricResultFailed, 1, 1.0, dogstatsd.Tag{Key: tagCategory, Value: string(CategoryOf(result.Err))}) // nolint: gas,errcheck
+	default:
+		s.Inc(metricResultSucceeded, 1, 1.0) // nolint: gas,errcheck
+	}
+}
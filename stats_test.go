@@ -0,0 +1,74 @@
+package kubernary
+
+import (
+	"testing"
+
+	"github.com/negz/kubernary/dogstatsd"
+
+	"github.com/cactus/go-statsd-client/statsd"
+	"github.com/pkg/errors"
+)
+
+type predictableSender struct {
+	sent []string
+}
+
+func (s *predictableSender) Send(data []byte) (int, error) {
+	s.sent = append(s.sent, string(data))
+	return len(data), nil
+}
+
+func (s *predictableSender) Close() error {
+	return nil
+}
+
+var statsRecorderTests = []struct {
+	name       string
+	err        error
+	want       string
+	wantTagged string
+}{
+	{
+		name:       "Succeeded",
+		want:       "kubernary.s3.result.succeeded:1|c",
+		wantTagged: "kubernary.result.succeeded:1|c|#check:s3",
+	},
+	{
+		name:       "Failed",
+		err:        NewCheckError(CategoryAuth, false, errors.New("denied")),
+		want:       "kubernary.s3.result.failed.auth:1|c",
+		wantTagged: "kubernary.result.failed:1|c|#category:auth,check:s3",
+	},
+	{
+		name:       "TimedOut",
+		err:        NewCheckError(CategoryTimeout, true, errors.New("slow")),
+		want:       "kubernary.s3.timeout:1|c",
+		wantTagged: "kubernary.timeout:1|c|#check:s3",
+	},
+}
+
+func TestStatsRecorder(t *testing.T) {
+	for _, tt := range statsRecorderTests {
+		t.Run(tt.name, func(t *testing.T) {
+			ps := &predictableSender{}
+			s, err := statsd.NewClientWithSender(ps, "kubernary")
+			if err != nil {
+				t.Fatalf("statsd.NewClientWithSender(): %v", err)
+			}
+			NewStatsRecorder(s).Record(&Result{Name: "s3", Err: tt.err})
+			if len(ps.sent) != 1 || ps.sent[0] != tt.want {
+				t.Errorf("ps.sent: want [%q], got %q", tt.want, ps.sent)
+			}
+
+			ts := &predictableSender{}
+			d, err := dogstatsd.New(ts, "kubernary", dogstatsd.FlushInterval(0))
+			if err != nil {
+				t.Fatalf("dogstatsd.New(): %v", err)
+			}
+			NewStatsRecorder(d).Record(&Result{Name: "s3", Err: tt.err})
+			if len(ts.sent) != 1 || ts.sent[0] != tt.wantTagged {
+				t.Errorf("ts.sent: want [%q], got %q", tt.wantTagged, ts.sent)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package kubernary
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	sparklineBarWidth = 4
+	sparklineHeight   = 20
+)
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>kubernary</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.4em 0.8em; text-align: left; border-bottom: 1px solid #ddd; vertical-align: top; }
+.passing { color: #2a7d2a; }
+.failing { color: #c62828; }
+.pending { color: #777; }
+.error { font-family: monospace; max-width: 40em; word-wrap: break-word; }
+</style>
+</head>
+<body>
+<h1>kubernary</h1>
+<p>Updated {{.Now.Format "2006-01-02 15:04:05 MST"}}.{{with .Node}} Running on node {{.Name}}{{with .Zone}} in {{.}}{{end}}.{{end}}</p>
+<table>
+<tr><th>Check</th><th>State</th><th>Last error</th><th>Last duration</th><th>Interval</th><th>Since last success</th><th>History</th></tr>
+{{range .Checks}}<tr>
+<td>{{.Name}}</td>
+<td class="{{.State}}">{{.State}}</td>
+<td class="error">{{.Error}}</td>
+<td>{{.Duration}}</td>
+<td>{{.Interval}}</td>
+<td>{{.SinceSuccess}}</td>
+<td><svg width="{{.Width}}" height="{{$.Height}}">{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{$.BarWidth}}" height="{{.Height}}" fill="{{.Fill}}"><title>{{.Title}}</title></rect>{{end}}</svg></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type bar struct {
+	X      int
+	Y      int
+	Height int
+	Fill   string
+	Title  string
+}
+
+type checkStatus struct {
+	Name         string
+	State        string
+	Error        string
+	Duration     string
+	Interval     time.Duration
+	SinceSuccess string
+	Width        int
+	Bars         []bar
+}
+
+type status struct {
+	Now      time.Time
+	Node     *Node
+	Refresh  int
+	Height   int
+	BarWidth int
+	Checks   []checkStatus
+}
+
+// sparkline returns one bar per result, scaled by duration and coloured by
+// outcome.
+func sparkline(rs []*Result) []bar {
+	longest := time.Duration(1)
+	for _, r := range rs {
+		if r.Duration > longest {
+			longest = r.Duration
+		}
+	}
+	bars := make([]bar, 0, len(rs))
+	for i, r := range rs {
+		// Bars are at least one pixel tall so that fast results are visible.
+		h := 1 + int(int64(sparklineHeight-1)*int64(r.Duration)/int64(longest))
+		b := bar{X: i * (sparklineBarWidth + 1), Y: sparklineHeight - h, Height: h, Fill: "#2a7d2a", Title: r.Time.Format(time.RFC3339) + " ok"}
+		if r.Err != nil {
+			b.Fill = "#c62828"
+			b.Title = r.Time.Format(time.RFC3339) + " " + r.Err.Error()
+		}
+		bars = append(bars, b)
+	}
+	return bars
+}
+
+func checkStatusOf(cfg *CheckConfig, h *History, now time.Time) checkStatus {
+	name := cfg.Checker.Name()
+	cs := checkStatus{Name: name, State: "pending", Interval: cfg.Interval, SinceSuccess: "never"}
+	if r := h.Latest(name); r != nil {
+		cs.State = "passing"
+		cs.Duration = r.Duration.String()
+		if r.Err != nil {
+			cs.State = "failing"
+			cs.Error = r.Err.Error()
+		}
+	}
+	if t := h.LastSuccess(name); !t.IsZero() {
+		cs.SinceSuccess = now.Sub(t).Round(time.Second).String()
+	}
+	cs.Bars = sparkline(h.Results(name))
+	cs.Width = len(cs.Bars) * (sparklineBarWidth + 1)
+	return cs
+}
+
+// StatusHandler returns an HTTP handler that renders an HTML page summarising
+// the most recent results of the supplied checks, as remembered by the
+// supplied History. The page refreshes itself every refresh interval.
+func StatusHandler(cfgs []*CheckConfig, h *History, refresh time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		s := &status{
+			Now:      time.Now(),
+			Refresh:  int(refresh.Seconds()),
+			Height:   sparklineHeight,
+			BarWidth: sparklineBarWidth,
+			Checks:   make([]checkStatus, 0, len(cfgs)),
+		}
+		for _, cfg := range cfgs {
+			if s.Node == nil {
+				s.Node = cfg.Node
+			}
+			s.Checks = append(s.Checks, checkStatusOf(cfg, h, s.Now))
+		}
+
+		b := &bytes.Buffer{}
+		if err := statusTemplate.Execute(b, s); err != nil {
+			http.Error(w, errors.Wrap(err, "cannot render status page").Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		b.WriteTo(w) // nolint: errcheck
+	}
+}
@@ -0,0 +1,44 @@
+package kubernary
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestStatusHandler(t *testing.T) {
+	cfgs := []*CheckConfig{
+		{Checker: &predictableChecker{name: "s3"}, Interval: time.Minute, Node: &Node{Name: "node-a", Zone: "us-east-1c"}},
+		{Checker: &predictableChecker{name: "sts"}, Interval: time.Minute},
+		{Checker: &predictableChecker{name: "imds"}, Interval: time.Minute},
+	}
+	h := NewHistory(10)
+	h.Record(&Result{Name: "s3", Time: time.Now(), Duration: time.Second})
+	h.Record(&Result{Name: "sts", Err: errors.New("<kaboom>"), Time: time.Now(), Duration: 2 * time.Second})
+
+	w := httptest.NewRecorder()
+	StatusHandler(cfgs, h, 10*time.Second)(w, httptest.NewRequest("GET", "/status", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code: want %v, got %v", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`content="10"`,
+		"node-a in us-east-1c",
+		`<td class="passing">passing</td>`,
+		`<td class="failing">failing</td>`,
+		`<td class="pending">pending</td>`,
+		"&lt;kaboom&gt;",
+		"<td>2s</td>",
+		"<td>never</td>",
+		`fill="#c62828"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("w.Body: want %q, got:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/negz/kubernary"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+const (
+	metricRuns     string = "kubernary.check.runs"
+	metricDuration string = "kubernary.check.duration"
+	metricUp       string = "kubernary.check.up"
+
+	// AttributeCheckResult is the result of a check run; succeeded, failed, or
+	// timeout.
+	AttributeCheckResult attribute.Key = "kubernary.check.result"
+
+	resultSucceeded string = "succeeded"
+	resultFailed    string = "failed"
+	resultTimeout   string = "timeout"
+)
+
+// NewMeterProvider returns a MeterProvider that periodically exports metrics to
+// an OTLP collector.
+func NewMeterProvider(ctx context.Context, o ...Option) (*sdkmetric.MeterProvider, error) {
+	c, err := newConfig(o)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Resource(ctx, c.node)
+	if err != nil {
+		return nil, err
+	}
+	if c.reader == nil {
+		var eo []otlpmetricgrpc.Option
+		if c.endpoint != "" {
+			eo = append(eo, otlpmetricgrpc.WithEndpoint(c.endpoint))
+		}
+		if c.headers != nil {
+			eo = append(eo, otlpmetricgrpc.WithHeaders(c.headers))
+		}
+		if c.insecure {
+			eo = append(eo, otlpmetricgrpc.WithInsecure())
+		}
+		e, err := otlpmetricgrpc.New(ctx, eo...)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot create OTLP metric exporter")
+		}
+		var ro []sdkmetric.PeriodicReaderOption
+		if c.interval > 0 {
+			ro = append(ro, sdkmetric.WithInterval(c.interval))
+		}
+		c.reader = sdkmetric.NewPeriodicReader(e, ro...)
+	}
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(c.reader), sdkmetric.WithResource(r)), nil
+}
+
+// A MetricsRecorder is a kubernary.Recorder that records OpenTelemetry metrics
+// for each result.
+type MetricsRecorder struct {
+	runs     metric.Int64Counter
+	duration metric.Float64Histogram
+	up       metric.Int64Gauge
+}
+
+// NewMetricsRecorder returns a Recorder that records metrics via the supplied
+// MeterProvider.
+func NewMetricsRecorder(mp metric.MeterProvider) (*MetricsRecorder, error) {
+	m := mp.Meter(kubernary.TracerName, metric.WithInstrumentationVersion(kubernary.Version))
+	runs, err := m.Int64Counter(metricRuns, metric.WithUnit("{run}"), metric.WithDescription("Check runs by result."))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create %s counter", metricRuns)
+	}
+	duration, err := m.Float64Histogram(metricDuration, metric.WithUnit("s"), metric.WithDescription("Duration of check runs."))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create %s histogram", metricDuration)
+	}
+	up, err := m.Int64Gauge(metricUp, metric.WithUnit("1"), metric.WithDescription("Whether the most recent check run passed."))
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot create %s gauge", metricUp)
+	}
+	return &MetricsRecorder{runs: runs, duration: duration, up: up}, nil
+}
+
+// Record counts the supplied result as a run of its check, records its
+// duration, and sets whether the check is up. Failed and timed out runs are
+// attributed with their failure category.
+func (r *MetricsRecorder) Record(result *kubernary.Result) {
+	ctx := context.Background()
+	name := kubernary.AttributeCheckName.String(result.Name)
+
+	attrs := []attribute.KeyValue{name, AttributeCheckResult.String(resultSucceeded)}
+	up := int64(1)
+	if result.Err != nil {
+		c := kubernary.CategoryOf(result.Err)
+		res := resultFailed
+		if c == kubernary.CategoryTimeout {
+			res = resultTimeout
+		}
+		attrs = []attribute.KeyValue{name, AttributeCheckResult.String(res), kubernary.AttributeCheckCategory.String(string(c))}
+		up = 0
+	}
+
+	r.runs.Add(ctx, 1, metric.WithAttributes(attrs...))
+	r.duration.Record(ctx, result.Duration.Seconds(), metric.WithAttributes(attrs[:2]...))
+	r.up.Record(ctx, up, metric.WithAttributes(name))
+}
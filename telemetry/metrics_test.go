@@ -0,0 +1,142 @@
+package telemetry
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/pkg/errors"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// A receiver is a stub OTLP metrics collector.
+type receiver struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+
+	m        sync.Mutex
+	headers  metadata.MD
+	resource map[string]string
+	metrics  map[string]*metricspb.Metric
+}
+
+func (r *receiver) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.headers, _ = metadata.FromIncomingContext(ctx)
+	for _, rm := range req.GetResourceMetrics() {
+		for _, kv := range rm.GetResource().GetAttributes() {
+			r.resource[kv.GetKey()] = kv.GetValue().GetStringValue()
+		}
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				r.metrics[m.GetName()] = m
+			}
+		}
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func serveReceiver(t *testing.T) (*receiver, string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen(): %v", err)
+	}
+	r := &receiver{resource: map[string]string{}, metrics: map[string]*metricspb.Metric{}}
+	s := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(s, r)
+	go s.Serve(l) // nolint: errcheck
+	t.Cleanup(s.Stop)
+	return r, l.Addr().String()
+}
+
+// sumOf returns the value of the supplied sum's data point with the supplied
+// check result.
+func sumOf(m *metricspb.Metric, result string) int64 {
+	for _, dp := range m.GetSum().GetDataPoints() {
+		for _, kv := range dp.GetAttributes() {
+			if kv.GetKey() == string(AttributeCheckResult) && kv.GetValue().GetStringValue() == result {
+				return dp.GetAsInt()
+			}
+		}
+	}
+	return 0
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	ctx := context.Background()
+	r, addr := serveReceiver(t)
+
+	n := &kubernary.Node{Name: "node-a", Pod: "kubernary-x7k2p"}
+	mp, err := NewMeterProvider(ctx,
+		Endpoint(addr),
+		Insecure(),
+		Headers(map[string]string{"x-token": "secret"}),
+		Interval(time.Hour),
+		Node(n))
+	if err != nil {
+		t.Fatalf("NewMeterProvider(): %v", err)
+	}
+	defer mp.Shutdown(ctx) // nolint: errcheck
+
+	rec, err := NewMetricsRecorder(mp)
+	if err != nil {
+		t.Fatalf("NewMetricsRecorder(): %v", err)
+	}
+	timeout := kubernary.NewCheckError(kubernary.CategoryTimeout, true, errors.New("slow"))
+	for _, result := range []*kubernary.Result{
+		{Name: "s3", Duration: time.Second},
+		{Name: "s3", Duration: time.Second},
+		{Name: "s3", Err: errors.New("boom"), Duration: time.Second},
+		{Name: "s3", Err: timeout, Duration: 2 * time.Second},
+	} {
+		rec.Record(result)
+	}
+	if err := mp.ForceFlush(ctx); err != nil {
+		t.Fatalf("mp.ForceFlush(): %v", err)
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if got := r.headers.Get("x-token"); len(got) != 1 || got[0] != "secret" {
+		t.Errorf("r.headers[x-token]: want [secret], got %v", got)
+	}
+	for k, v := range map[string]string{"service.name": serviceName, "k8s.node.name": "node-a", "k8s.pod.name": "kubernary-x7k2p"} {
+		if r.resource[k] != v {
+			t.Errorf("r.resource[%s]: want %s, got %s", k, v, r.resource[k])
+		}
+	}
+
+	runs, ok := r.metrics[metricRuns]
+	if !ok {
+		t.Fatalf("r.metrics[%s]: want metric, got none", metricRuns)
+	}
+	for result, want := range map[string]int64{resultSucceeded: 2, resultFailed: 1, resultTimeout: 1} {
+		if got := sumOf(runs, result); got != want {
+			t.Errorf("%s{%s=%s}: want %d, got %d", metricRuns, AttributeCheckResult, result, want, got)
+		}
+	}
+	if _, ok := r.metrics[metricDuration]; !ok {
+		t.Errorf("r.metrics[%s]: want metric, got none", metricDuration)
+	}
+	up, ok := r.metrics[metricUp]
+	if !ok {
+		t.Fatalf("r.metrics[%s]: want metric, got none", metricUp)
+	}
+	if dps := up.GetGauge().GetDataPoints(); len(dps) != 1 || dps[0].GetAsInt() != 0 {
+		t.Errorf("%s: want one data point of 0, got %v", metricUp, dps)
+	}
+}
+
+func TestInterval(t *testing.T) {
+	if _, err := NewMeterProvider(context.Background(), Interval(0)); err == nil {
+		t.Error("NewMeterProvider(Interval(0)): want error, got nil")
+	}
+}
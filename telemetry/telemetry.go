@@ -0,0 +1,160 @@
+// Package telemetry exports OpenTelemetry traces and metrics describing
+// kubernary check runs to an OTLP collector.
+package telemetry
+
+import (
+	"context"
+	"time"
+
+	"github.com/negz/kubernary"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const serviceName string = "kubernary"
+
+type config struct {
+	endpoint string
+	headers  map[string]string
+	insecure bool
+	interval time.Duration
+	node     *kubernary.Node
+	spans    sdktrace.SpanExporter
+	reader   sdkmetric.Reader
+}
+
+// An Option represents a telemetry option.
+type Option func(*config) error
+
+// Endpoint sets the address of the OTLP gRPC collector, i.e. collector:4317.
+// The collector is otherwise configured via the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT environment variable and friends.
+func Endpoint(addr string) Option {
+	return func(c *config) error {
+		c.endpoint = addr
+		return nil
+	}
+}
+
+// Headers are sent with each export to the OTLP collector, e.g. to
+// authenticate.
+func Headers(h map[string]string) Option {
+	return func(c *config) error {
+		c.headers = h
+		return nil
+	}
+}
+
+// Insecure causes telemetry to be exported to the OTLP collector via plain,
+// unencrypted gRPC.
+func Insecure() Option {
+	return func(c *config) error {
+		c.insecure = true
+		return nil
+	}
+}
+
+// Interval sets how often metrics are exported. Defaults to one minute.
+func Interval(d time.Duration) Option {
+	return func(c *config) error {
+		if d <= 0 {
+			return errors.Errorf("interval must be positive, got %s", d)
+		}
+		c.interval = d
+		return nil
+	}
+}
+
+// Node describes where kubernary is running. Its details are attached to all
+// exported telemetry.
+func Node(n *kubernary.Node) Option {
+	return func(c *config) error {
+		c.node = n
+		return nil
+	}
+}
+
+// SpanExporter allows the use of a bespoke span exporter rather than OTLP.
+func SpanExporter(e sdktrace.SpanExporter) Option {
+	return func(c *config) error {
+		c.spans = e
+		return nil
+	}
+}
+
+// MetricReader allows the use of a bespoke metric reader rather than
+// periodically exporting metrics via OTLP.
+func MetricReader(r sdkmetric.Reader) Option {
+	return func(c *config) error {
+		c.reader = r
+		return nil
+	}
+}
+
+func newConfig(o []Option) (*config, error) {
+	c := &config{}
+	for _, opt := range o {
+		if err := opt(c); err != nil {
+			return nil, errors.Wrap(err, "cannot apply telemetry option")
+		}
+	}
+	return c, nil
+}
+
+// Resource returns an OpenTelemetry resource describing kubernary and, if
+// supplied, the node on which it runs.
+func Resource(ctx context.Context, n *kubernary.Node) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		attribute.String("service.name", serviceName),
+		attribute.String("service.version", kubernary.Version),
+	}
+	if n != nil {
+		for k, v := range map[string]string{
+			"k8s.node.name":           n.Name,
+			"k8s.pod.name":            n.Pod,
+			"k8s.namespace.name":      n.Namespace,
+			"cloud.availability_zone": n.Zone,
+		} {
+			if v != "" {
+				attrs = append(attrs, attribute.String(k, v))
+			}
+		}
+	}
+	r, err := resource.New(ctx, resource.WithFromEnv(), resource.WithTelemetrySDK(), resource.WithAttributes(attrs...))
+	return r, errors.Wrap(err, "cannot create telemetry resource")
+}
+
+// NewTracerProvider returns a TracerProvider that batches spans and exports
+// them to an OTLP collector. Callers should typically install it via
+// otel.SetTracerProvider so that check runs are traced.
+func NewTracerProvider(ctx context.Context, o ...Option) (*sdktrace.TracerProvider, error) {
+	c, err := newConfig(o)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Resource(ctx, c.node)
+	if err != nil {
+		return nil, err
+	}
+	if c.spans == nil {
+		var eo []otlptracegrpc.Option
+		if c.endpoint != "" {
+			eo = append(eo, otlptracegrpc.WithEndpoint(c.endpoint))
+		}
+		if c.headers != nil {
+			eo = append(eo, otlptracegrpc.WithHeaders(c.headers))
+		}
+		if c.insecure {
+			eo = append(eo, otlptracegrpc.WithInsecure())
+		}
+		if c.spans, err = otlptracegrpc.New(ctx, eo...); err != nil {
+			return nil, errors.Wrap(err, "cannot create OTLP span exporter")
+		}
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(c.spans), sdktrace.WithResource(r)), nil
+}
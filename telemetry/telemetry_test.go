@@ -0,0 +1,48 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/negz/kubernary"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	ctx := context.Background()
+	exp := tracetest.NewInMemoryExporter()
+	n := &kubernary.Node{Name: "node-a", Zone: "us-east-1c"}
+	tp, err := NewTracerProvider(ctx, SpanExporter(exp), Node(n))
+	if err != nil {
+		t.Fatalf("NewTracerProvider(): %v", err)
+	}
+
+	_, span := tp.Tracer(kubernary.TracerName).Start(ctx, "check")
+	span.End()
+	if err := tp.ForceFlush(ctx); err != nil {
+		t.Fatalf("tp.ForceFlush(): %v", err)
+	}
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("exp.GetSpans(): want 1 span, got %d", len(spans))
+	}
+	got := map[string]string{}
+	for _, kv := range spans[0].Resource.Attributes() {
+		got[string(kv.Key)] = kv.Value.Emit()
+	}
+	want := map[string]string{
+		"service.name":            serviceName,
+		"k8s.node.name":           "node-a",
+		"cloud.availability_zone": "us-east-1c",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("spans[0].Resource[%s]: want %s, got %s", k, v, got[k])
+		}
+	}
+	if _, ok := got["k8s.pod.name"]; ok {
+		t.Errorf("spans[0].Resource[k8s.pod.name]: want unset, got %s", got["k8s.pod.name"])
+	}
+}
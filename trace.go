@@ -0,0 +1,47 @@
+package kubernary
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the name of the OpenTelemetry tracer used to trace check runs.
+// Checks should use it when creating spans of their own.
+const TracerName string = "github.com/negz/kubernary"
+
+const spanCheck string = "kubernary.check"
+
+// Attribute keys set on the spans of check runs.
+const (
+	AttributeCheckName     attribute.Key = "kubernary.check.name"
+	AttributeCheckCategory attribute.Key = "kubernary.check.category"
+	AttributeCheckTimeout  attribute.Key = "kubernary.check.timeout"
+)
+
+// Tracer returns the tracer used to trace check runs, as provided by the global
+// OpenTelemetry TracerProvider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(TracerName)
+}
+
+func startSpan(ctx context.Context, cfg *CheckConfig) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, spanCheck, trace.WithAttributes(
+		AttributeCheckName.String(cfg.Checker.Name()),
+		AttributeCheckTimeout.String(cfg.Timeout.String()),
+	))
+}
+
+func endSpan(span trace.Span, r *Result) {
+	defer span.End()
+	if r.Err == nil {
+		span.SetStatus(codes.Ok, "")
+		return
+	}
+	span.SetAttributes(AttributeCheckCategory.String(string(CategoryOf(r.Err))))
+	span.RecordError(r.Err)
+	span.SetStatus(codes.Error, r.Err.Error())
+}
@@ -0,0 +1,106 @@
+package kubernary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// steppedChecker traces a child span of each run.
+type steppedChecker struct {
+	predictableChecker
+}
+
+func (c *steppedChecker) CheckContext(ctx context.Context) error {
+	_, span := Tracer().Start(ctx, "step")
+	defer span.End()
+	return c.Check()
+}
+
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exp := tracetest.NewInMemoryExporter()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return exp
+}
+
+func TestTraceCheck(t *testing.T) {
+	cases := []struct {
+		name         string
+		cfg          *CheckConfig
+		wantStatus   codes.Code
+		wantCategory Category
+	}{
+		{
+			name:       "Passed",
+			cfg:        &CheckConfig{Checker: &predictableChecker{name: "pass"}},
+			wantStatus: codes.Ok,
+		},
+		{
+			name:         "Failed",
+			cfg:          &CheckConfig{Checker: &predictableChecker{name: "fail", err: errors.New("boom")}},
+			wantStatus:   codes.Error,
+			wantCategory: CategoryUnknown,
+		},
+		{
+			name: "TimedOut",
+			cfg: &CheckConfig{
+				Checker: &predictableChecker{name: testWillTimeout, do: func() { time.Sleep(100 * time.Millisecond) }},
+				Timeout: 10 * time.Millisecond,
+			},
+			wantStatus:   codes.Error,
+			wantCategory: CategoryTimeout,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := recordSpans(t)
+			runOne(context.Background(), tt.cfg)
+
+			spans := exp.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("exp.GetSpans(): want 1 span, got %d", len(spans))
+			}
+			s := spans[0]
+			if s.Name != spanCheck {
+				t.Errorf("s.Name: want %s, got %s", spanCheck, s.Name)
+			}
+			if s.Status.Code != tt.wantStatus {
+				t.Errorf("s.Status.Code: want %v, got %v", tt.wantStatus, s.Status.Code)
+			}
+			attrs := map[string]string{}
+			for _, kv := range s.Attributes {
+				attrs[string(kv.Key)] = kv.Value.Emit()
+			}
+			if attrs[string(AttributeCheckName)] != tt.cfg.Checker.Name() {
+				t.Errorf("%s: want %s, got %s", AttributeCheckName, tt.cfg.Checker.Name(), attrs[string(AttributeCheckName)])
+			}
+			if attrs[string(AttributeCheckCategory)] != string(tt.wantCategory) {
+				t.Errorf("%s: want %s, got %s", AttributeCheckCategory, tt.wantCategory, attrs[string(AttributeCheckCategory)])
+			}
+		})
+	}
+}
+
+func TestTraceContextCheck(t *testing.T) {
+	exp := recordSpans(t)
+	runOne(context.Background(), &CheckConfig{Checker: &steppedChecker{predictableChecker{name: "steps"}}})
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("exp.GetSpans(): want 2 spans, got %d", len(spans))
+	}
+	// Spans are exported as they end, so the child span is exported first.
+	step, run := spans[0], spans[1]
+	if step.Parent.SpanID() != run.SpanContext.SpanID() {
+		t.Errorf("step.Parent.SpanID(): want %s, got %s", run.SpanContext.SpanID(), step.Parent.SpanID())
+	}
+}